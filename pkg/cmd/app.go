@@ -0,0 +1,485 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/apimachinery/pkg/util/wait"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+	"k8s.io/kube-openapi/pkg/validation/strfmt"
+	"k8s.io/kube-openapi/pkg/validation/validate"
+)
+
+var (
+	// crdResource serves the CustomResourceDefinitions the application manifests are validated against
+	crdResource = schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}
+	// oamApplicationResource is the wadm Application, used when no Cosmonic Application resource is served
+	oamApplicationResource = schema.GroupVersionResource{Group: "core.oam.dev", Version: "v1beta1", Resource: "applications"}
+)
+
+// deployedStatuses are the application statuses that mean every component has been placed
+var deployedStatuses = []string{"deployed", "ready"}
+
+// failedStatuses are the application statuses that will not become deployed without a change
+var failedStatuses = []string{"failed"}
+
+type AppConfig struct {
+	namespace     string
+	allNamespaces bool
+	file          string
+	output        string
+	timeout       time.Duration
+	genericiooptions.IOStreams
+
+	client  kubernetes.Interface
+	dynamic dynamic.Interface
+}
+
+func NewCmdApp(streams genericiooptions.IOStreams) *cobra.Command {
+	app := &AppConfig{IOStreams: streams}
+
+	cmd := &cobra.Command{
+		Use:   "app [command] [flags]",
+		Short: "Deploy and manage Wasm applications",
+	}
+	cmd.PersistentFlags().StringVarP(&app.namespace, "namespace", "n", "", "namespace of the applications (default the namespace of the current context)")
+
+	deployCmd := &cobra.Command{
+		Use:   "deploy -f <file> [flags]",
+		Short: "Create or update the applications in a manifest, after validating them against the installed CRD",
+		Example: `  kubectl cosmo app deploy -f app.yaml
+  kubectl cosmo app status hello`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := app.Initialize(cmd, args); err != nil {
+				return err
+			}
+
+			return app.Deploy(cmd.Context())
+		},
+	}
+	deployCmd.Flags().StringVarP(&app.file, "filename", "f", "", "application manifest, - for stdin")
+	deployCmd.MarkFlagRequired("filename")
+
+	listCmd := &cobra.Command{
+		Use:   "list [flags]",
+		Short: "List the deployed applications and their status",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := app.Initialize(cmd, args); err != nil {
+				return err
+			}
+			if err := validateOutputFormat(app.output); err != nil {
+				return err
+			}
+
+			return app.List(cmd.Context())
+		},
+	}
+	listCmd.Flags().BoolVarP(&app.allNamespaces, "all-namespaces", "A", false, "list across all namespaces")
+	listCmd.Flags().StringVarP(&app.output, "output", "o", "", "output format, one of json or yaml")
+
+	statusCmd := &cobra.Command{
+		Use:   "status <name> [flags]",
+		Short: "Wait for an application to report deployed, showing the components that could not be placed",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := app.Initialize(cmd, args); err != nil {
+				return err
+			}
+
+			return app.Status(cmd.Context(), args[0])
+		},
+	}
+	statusCmd.Flags().DurationVar(&app.timeout, "timeout", 2*time.Minute, "how long to wait for the application to report deployed, 0 to only print the current status")
+
+	deleteCmd := &cobra.Command{
+		Use:   "delete <name> [flags]",
+		Short: "Delete an application",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := app.Initialize(cmd, args); err != nil {
+				return err
+			}
+
+			return app.Delete(cmd.Context(), args[0])
+		},
+	}
+
+	cmd.AddCommand(deployCmd)
+	cmd.AddCommand(listCmd)
+	cmd.AddCommand(statusCmd)
+	cmd.AddCommand(deleteCmd)
+
+	return cmd
+}
+
+// Initialize builds the kubernetes clients and resolves the namespace
+func (app *AppConfig) Initialize(cmd *cobra.Command, args []string) error {
+	client, config, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+	app.client = client
+
+	app.dynamic, err = dynamic.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+
+	if app.namespace == "" {
+		app.namespace, err = currentNamespace()
+	}
+	return err
+}
+
+// applicationResource is the Application custom resource served by the cluster
+func (app *AppConfig) applicationResource() (schema.GroupVersionResource, error) {
+	resource, found, err := cosmonicResource(app.client, "Application")
+	if err != nil || found {
+		return resource, err
+	}
+	if hasResource(app.client, oamApplicationResource.GroupVersion().String(), oamApplicationResource.Resource) {
+		return oamApplicationResource, nil
+	}
+	return resource, errors.New("the Application resource is not served by the cluster, is Cosmonic Control installed?")
+}
+
+// Deploy validates every object in the manifest before creating or updating any of them
+func (app *AppConfig) Deploy(ctx context.Context) error {
+	objects, err := readManifest(app.file, app.In)
+	if err != nil {
+		return err
+	}
+	if len(objects) == 0 {
+		return fmt.Errorf("no objects found in %s", app.file)
+	}
+
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(app.client.Discovery()))
+
+	clients := make([]dynamic.ResourceInterface, len(objects))
+	for i, object := range objects {
+		gvk := object.GroupVersionKind()
+		mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return fmt.Errorf("%s %s: %w", gvk.Kind, object.GetName(), err)
+		}
+
+		if err := app.validate(ctx, mapping.Resource, object); err != nil {
+			return err
+		}
+
+		if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+			if object.GetNamespace() == "" {
+				object.SetNamespace(app.namespace)
+			}
+			clients[i] = app.dynamic.Resource(mapping.Resource).Namespace(object.GetNamespace())
+		} else {
+			clients[i] = app.dynamic.Resource(mapping.Resource)
+		}
+	}
+
+	for i, object := range objects {
+		client := clients[i]
+		name := fmt.Sprintf("%s/%s", strings.ToLower(object.GetKind()), object.GetName())
+
+		existing, err := client.Get(ctx, object.GetName(), v1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			if _, err := client.Create(ctx, object, v1.CreateOptions{}); err != nil {
+				return fmt.Errorf("failed to create %s: %w", name, err)
+			}
+			fmt.Fprintf(app.Out, "%s created\n", name)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		object.SetResourceVersion(existing.GetResourceVersion())
+		if _, err := client.Update(ctx, object, v1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("failed to update %s: %w", name, err)
+		}
+		fmt.Fprintf(app.Out, "%s configured\n", name)
+	}
+
+	return nil
+}
+
+// validate checks the object against the OpenAPI schema of its CRD version, reporting every violation
+func (app *AppConfig) validate(ctx context.Context, resource schema.GroupVersionResource, object *unstructured.Unstructured) error {
+	crdName := resource.Resource + "." + resource.Group
+	crd, err := app.dynamic.Resource(crdResource).Get(ctx, crdName, v1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return fmt.Errorf("%s is not a custom resource installed in the cluster", object.GetKind())
+	}
+	if err != nil {
+		return err
+	}
+
+	versions, _, _ := unstructured.NestedSlice(crd.Object, "spec", "versions")
+	var openAPISchema map[string]interface{}
+	for _, v := range versions {
+		version, ok := v.(map[string]interface{})
+		if !ok || version["name"] != resource.Version {
+			continue
+		}
+		openAPISchema, _, _ = unstructured.NestedMap(version, "schema", "openAPIV3Schema")
+	}
+	if openAPISchema == nil {
+		// without a schema the API server accepts any object of the kind
+		return nil
+	}
+
+	data, err := json.Marshal(openAPISchema)
+	if err != nil {
+		return err
+	}
+	s := &spec.Schema{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return fmt.Errorf("failed to read the schema of %s: %w", crdName, err)
+	}
+
+	result := validate.NewSchemaValidator(s, nil, "", strfmt.Default).Validate(object.Object)
+	if result.IsValid() {
+		return nil
+	}
+
+	var problems []string
+	for _, err := range result.Errors {
+		problems = append(problems, "  "+err.Error())
+	}
+	return fmt.Errorf("%s %s is not valid:\n%s", object.GetKind(), object.GetName(), strings.Join(problems, "\n"))
+}
+
+// List prints the applications with their status
+func (app *AppConfig) List(ctx context.Context) error {
+	resource, err := app.applicationResource()
+	if err != nil {
+		return err
+	}
+
+	namespace := app.namespace
+	if app.allNamespaces {
+		namespace = v1.NamespaceAll
+	}
+	list, err := app.dynamic.Resource(resource).Namespace(namespace).List(ctx, v1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	if app.output != "" {
+		return printStructured(app.Out, app.output, list.Items)
+	}
+	if len(list.Items) == 0 {
+		fmt.Fprintln(app.ErrOut, "No resources found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(app.Out, 0, 0, 3, ' ', 0)
+	if app.allNamespaces {
+		fmt.Fprint(w, "NAMESPACE\t")
+	}
+	fmt.Fprintln(w, "NAME\tVERSION\tSTATUS\tAGE")
+	for i := range list.Items {
+		item := &list.Items[i]
+		if app.allNamespaces {
+			fmt.Fprintf(w, "%s\t", item.GetNamespace())
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", item.GetName(), orDash(applicationVersion(item)), orDash(workloadStatus(item)),
+			duration.HumanDuration(time.Since(item.GetCreationTimestamp().Time)))
+	}
+	return w.Flush()
+}
+
+// Status waits until the application reports deployed. When it fails or the timeout expires the
+// components that are not placed are listed with the reason.
+func (app *AppConfig) Status(ctx context.Context, name string) error {
+	resource, err := app.applicationResource()
+	if err != nil {
+		return err
+	}
+	client := app.dynamic.Resource(resource).Namespace(app.namespace)
+
+	var current *unstructured.Unstructured
+	lastStatus := ""
+	check := func(ctx context.Context) (bool, error) {
+		object, err := client.Get(ctx, name, v1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		current = object
+
+		status := workloadStatus(current)
+		if status != lastStatus {
+			fmt.Fprintf(app.Out, "application/%s: %s\n", name, orDash(status))
+			lastStatus = status
+		}
+		if statusIn(status, failedStatuses) {
+			return false, fmt.Errorf("application %s %s", name, strings.ToLower(status))
+		}
+		return statusIn(status, deployedStatuses), nil
+	}
+
+	if app.timeout == 0 {
+		deployed, err := check(ctx)
+		if err == nil && !deployed {
+			app.printPlacementFailures(current)
+		}
+		return err
+	}
+
+	err = wait.PollUntilContextTimeout(ctx, 2*time.Second, app.timeout, true, check)
+	if err == nil {
+		return nil
+	}
+	if current == nil || apierrors.IsNotFound(err) {
+		return err
+	}
+
+	app.printPlacementFailures(current)
+	if wait.Interrupted(err) {
+		return fmt.Errorf("application %s did not report deployed within %s", name, app.timeout)
+	}
+	return err
+}
+
+// printPlacementFailures lists the components of the application that are not deployed, and the
+// conditions that are not met
+func (app *AppConfig) printPlacementFailures(object *unstructured.Unstructured) {
+	w := tabwriter.NewWriter(app.Out, 0, 0, 3, ' ', 0)
+	header := false
+	row := func(name, status, message string) {
+		if !header {
+			fmt.Fprintln(w, "COMPONENT\tSTATUS\tMESSAGE")
+			header = true
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", name, orDash(status), orDash(message))
+	}
+
+	for _, field := range []string{"components", "scalers"} {
+		entries, _, _ := unstructured.NestedSlice(object.Object, "status", field)
+		for _, e := range entries {
+			entry, ok := e.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			status := stringField(entry, "status", "phase", "state")
+			if statusIn(status, deployedStatuses) {
+				continue
+			}
+			row(stringField(entry, "name", "id", "kind"), status, stringField(entry, "message", "reason"))
+		}
+	}
+
+	conditions, _, _ := unstructured.NestedSlice(object.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok || condition["status"] == "True" {
+			continue
+		}
+		row("condition/"+stringField(condition, "type"), stringField(condition, "reason"), stringField(condition, "message"))
+	}
+
+	if header {
+		fmt.Fprintln(app.Out)
+		w.Flush()
+	}
+}
+
+// Delete removes the application
+func (app *AppConfig) Delete(ctx context.Context, name string) error {
+	resource, err := app.applicationResource()
+	if err != nil {
+		return err
+	}
+
+	if err := app.dynamic.Resource(resource).Namespace(app.namespace).Delete(ctx, name, v1.DeleteOptions{}); err != nil {
+		return err
+	}
+	fmt.Fprintf(app.Out, "application/%s deleted\n", name)
+	return nil
+}
+
+// readManifest decodes the objects of a multi-document YAML or JSON file, - reads from in
+func readManifest(file string, in io.Reader) ([]*unstructured.Unstructured, error) {
+	var data []byte
+	var err error
+	if file == "-" {
+		data, err = io.ReadAll(in)
+	} else {
+		data, err = os.ReadFile(file)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+	var objects []*unstructured.Unstructured
+	for {
+		object := map[string]interface{}{}
+		err := decoder.Decode(&object)
+		if errors.Is(err, io.EOF) {
+			return objects, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+		}
+		if len(object) == 0 {
+			continue
+		}
+
+		u := &unstructured.Unstructured{Object: object}
+		if u.GetKind() == "" || u.GetAPIVersion() == "" || u.GetName() == "" {
+			return nil, fmt.Errorf("%s: every object needs an apiVersion, kind and metadata.name", file)
+		}
+		objects = append(objects, u)
+	}
+}
+
+// applicationVersion is the version of the application spec, or the wadm version annotation
+func applicationVersion(object *unstructured.Unstructured) string {
+	if version := firstNestedString(object, []string{"spec", "version"}, []string{"status", "version"}); version != "" {
+		return version
+	}
+	return object.GetAnnotations()["version"]
+}
+
+// stringField returns the first non-empty string among the keys of a status entry
+func stringField(entry map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		if value, ok := entry[key].(string); ok && value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func statusIn(status string, statuses []string) bool {
+	for _, s := range statuses {
+		if strings.EqualFold(status, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadManifest(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		want     []string
+		wantErr  bool
+	}{
+		{
+			name: "single application",
+			manifest: `apiVersion: core.oam.dev/v1beta1
+kind: Application
+metadata:
+  name: hello
+`,
+			want: []string{"Application/hello"},
+		},
+		{
+			name: "several documents with an empty one",
+			manifest: `---
+apiVersion: core.oam.dev/v1beta1
+kind: Application
+metadata:
+  name: hello
+---
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: hello-config
+`,
+			want: []string{"Application/hello", "ConfigMap/hello-config"},
+		},
+		{
+			name:     "JSON",
+			manifest: `{"apiVersion": "core.oam.dev/v1beta1", "kind": "Application", "metadata": {"name": "hello"}}`,
+			want:     []string{"Application/hello"},
+		},
+		{
+			name:     "empty file",
+			manifest: "",
+		},
+		{
+			name: "no name",
+			manifest: `apiVersion: core.oam.dev/v1beta1
+kind: Application
+`,
+			wantErr: true,
+		},
+		{
+			name:     "not YAML",
+			manifest: "kind: [Application",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := func(t *testing.T, file string, in string) {
+				objects, err := readManifest(file, strings.NewReader(in))
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("readManifest() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				var got []string
+				for _, object := range objects {
+					got = append(got, object.GetKind()+"/"+object.GetName())
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("readManifest() = %v, want %v", got, tt.want)
+				}
+			}
+
+			t.Run("stdin", func(t *testing.T) {
+				check(t, "-", tt.manifest)
+			})
+			t.Run("file", func(t *testing.T) {
+				file := filepath.Join(t.TempDir(), "app.yaml")
+				if err := os.WriteFile(file, []byte(tt.manifest), 0o600); err != nil {
+					t.Fatal(err)
+				}
+				check(t, file, "")
+			})
+		})
+	}
+}
+
+func TestStatusIn(t *testing.T) {
+	tests := []struct {
+		status   string
+		statuses []string
+		want     bool
+	}{
+		{status: "Deployed", statuses: []string{"deployed"}, want: true},
+		{status: "failed", statuses: []string{"Deployed", "Failed"}, want: true},
+		{status: "reconciling", statuses: []string{"deployed", "failed"}},
+		{status: "", statuses: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			if got := statusIn(tt.status, tt.statuses); got != tt.want {
+				t.Errorf("statusIn(%q, %v) = %v, want %v", tt.status, tt.statuses, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,397 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	chartManager "github.com/cosmonic/kubectl-cosmo/pkg/internal/chartmanager"
+	"github.com/cosmonic/kubectl-cosmo/pkg/internal/license"
+	"github.com/cosmonic/kubectl-cosmo/pkg/internal/platform"
+	"github.com/spf13/cobra"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/release"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+)
+
+const (
+	planInstall   = "install"
+	planUpgrade   = "upgrade"
+	planUninstall = "uninstall"
+	planUnchanged = "unchanged"
+	planLicense   = "apply-license"
+)
+
+// planAction is one change needed to reconcile the cluster to the platform config
+type planAction struct {
+	action      string
+	releaseName string
+	chartName   string
+	from        string
+	to          string
+	opts        chartManager.ReleaseOptions
+	// kept are the installed values the config does not set, carried over by the upgrade
+	kept []string
+}
+
+type ApplyConfig struct {
+	manager     *chartManager.ChartManager
+	configFlags *genericclioptions.ConfigFlags
+	platform    *platform.Config
+	file        string
+	dryRun      bool
+	genericiooptions.IOStreams
+
+	logger *log.Logger
+}
+
+func NewCmdApply(streams genericiooptions.IOStreams) *cobra.Command {
+	apply := &ApplyConfig{configFlags: genericclioptions.NewConfigFlags(true), IOStreams: streams, logger: log.Default()}
+
+	cmd := &cobra.Command{
+		Use:   "apply -f <file> [flags]",
+		Short: "Reconcile the cluster to a declarative Cosmonic Control config file",
+		Example: `  # cosmo.yaml
+  namespace: cosmonic-system
+  registry: oci://ghcr.io/cosmonic
+  license:
+    file: ./license.key
+  nexus:
+    version: 0.2.0
+    values: {}
+  hostgroups:
+    - name: hostgroup
+      version: 0.2.0
+      values: {}
+
+  kubectl cosmo apply -f cosmo.yaml --dry-run`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := apply.Initialize(cmd, args); err != nil {
+				return err
+			}
+			if err := apply.Validate(); err != nil {
+				return err
+			}
+
+			return apply.Run(cmd.Context())
+		},
+	}
+
+	cmd.Flags().StringVarP(&apply.file, "filename", "f", "", "platform config file to apply")
+	cmd.Flags().BoolVar(&apply.dryRun, "dry-run", false, "only show the plan, without changing the cluster")
+	cmd.MarkFlagRequired("filename")
+
+	return cmd
+}
+
+// Initialize loads the config file and configures the chart manager for its namespace and registry
+func (apply *ApplyConfig) Initialize(cmd *cobra.Command, args []string) error {
+	config, err := platform.Load(apply.file)
+	if err != nil {
+		return err
+	}
+	apply.platform = config
+
+	helmDriver := os.Getenv("HELM_DRIVER")
+	manager, err := chartManager.New(apply.IOStreams, helmDriver, log.Default(),
+		chartManager.WithNamespace(config.Namespace), chartManager.WithRegistry(config.Registry))
+	if err != nil {
+		return err
+	}
+	apply.manager = manager
+
+	return nil
+}
+
+// Validate checks that no hostgroup reuses the nexus release name
+func (apply *ApplyConfig) Validate() error {
+	for _, hostgroup := range apply.platform.Hostgroups {
+		if hostgroup.Name == controlChartName {
+			return fmt.Errorf("hostgroup name %q is reserved for the nexus", controlChartName)
+		}
+	}
+	return nil
+}
+
+// Run computes the plan and, unless this is a dry run, executes it in order
+func (apply *ApplyConfig) Run(ctx context.Context) error {
+	plan, err := apply.plan(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := apply.printPlan(plan); err != nil {
+		return err
+	}
+	if apply.dryRun {
+		return nil
+	}
+
+	changed := false
+	for _, step := range plan {
+		if step.action == planUnchanged {
+			continue
+		}
+		changed = true
+
+		fmt.Fprintf(apply.Out, "%s %s...\n", step.action, step.releaseName)
+		if err := apply.execute(ctx, step); err != nil {
+			return fmt.Errorf("failed to %s %s: %w", step.action, step.releaseName, err)
+		}
+	}
+
+	if !changed {
+		fmt.Fprintln(apply.Out, "cluster already matches the config")
+	}
+	return nil
+}
+
+// plan diffs the config against the installed releases: the nexus first, then the hostgroups,
+// then removals of hostgroups that are no longer declared
+func (apply *ApplyConfig) plan(ctx context.Context) ([]planAction, error) {
+	var plan []planAction
+
+	if apply.platform.License != nil {
+		step, err := apply.planLicense(ctx)
+		if err != nil {
+			return nil, err
+		}
+		plan = append(plan, step)
+	}
+
+	step, err := apply.planRelease(ctx, controlChartName, controlChartName, apply.platform.Nexus)
+	if err != nil {
+		return nil, err
+	}
+	plan = append(plan, step)
+
+	for _, hostgroup := range apply.platform.Hostgroups {
+		step, err := apply.planRelease(ctx, hostgroup.Name, hostgroupRepoChartName, hostgroup.Release)
+		if err != nil {
+			return nil, err
+		}
+		plan = append(plan, step)
+	}
+
+	installed, err := apply.manager.ListReleases(hostgroupRepoChartName)
+	if err != nil {
+		return nil, err
+	}
+	plan = append(plan, planRemovals(installed, apply.platform.Hostgroups)...)
+
+	return plan, nil
+}
+
+// planRemovals uninstalls the installed hostgroup releases the config no longer declares
+func planRemovals(installed []string, hostgroups []platform.Hostgroup) []planAction {
+	declared := map[string]bool{}
+	for _, hostgroup := range hostgroups {
+		declared[hostgroup.Name] = true
+	}
+
+	var plan []planAction
+	for _, releaseName := range installed {
+		if !declared[releaseName] {
+			plan = append(plan, planAction{action: planUninstall, releaseName: releaseName, chartName: hostgroupRepoChartName})
+		}
+	}
+	return plan
+}
+
+func (apply *ApplyConfig) planRelease(ctx context.Context, releaseName string, chartName string, desired platform.Release) (planAction, error) {
+	step := planAction{
+		releaseName: releaseName,
+		chartName:   chartName,
+		to:          desired.Version,
+		opts:        chartManager.ReleaseOptions{Version: desired.Version, Values: desired.Values},
+	}
+
+	if step.to == "" {
+		latest, err := apply.manager.GetRepoChartVersion(ctx, chartName)
+		if err != nil {
+			return step, err
+		}
+		step.to = latest
+		step.opts.Version = latest
+	}
+
+	// rel is nil when the release is not installed
+	rel, err := apply.manager.GetRelease(releaseName)
+	if err != nil && !errors.Is(err, chartManager.ErrReleaseNotFound) {
+		return step, err
+	}
+
+	return step, diffRelease(&step, rel, desired.Values)
+}
+
+// diffRelease sets the action taking the installed release, nil when there is none, to the version
+// and values of the step. Installed values the config does not set, such as the join values of
+// hostgroup install --join, are kept rather than reset to the chart defaults.
+func diffRelease(step *planAction, rel *release.Release, values map[string]interface{}) error {
+	if rel == nil {
+		step.action = planInstall
+		return nil
+	}
+
+	desired, err := normalizeValues(values)
+	if err != nil {
+		return err
+	}
+	step.opts.Values = chartutil.MergeTables(desired, rel.Config)
+	step.kept = undeclaredPaths(rel.Config, values)
+
+	step.from = rel.Chart.Metadata.Version
+	step.action = planUnchanged
+	if step.from != step.to {
+		step.action = planUpgrade
+		return nil
+	}
+
+	same, err := sameValues(rel.Config, step.opts.Values)
+	if err != nil {
+		return err
+	}
+	if !same {
+		step.action = planUpgrade
+	}
+	return nil
+}
+
+func (apply *ApplyConfig) planLicense(ctx context.Context) (planAction, error) {
+	step := planAction{action: planLicense, releaseName: "license"}
+
+	key, err := os.ReadFile(apply.platform.License.File)
+	if err != nil {
+		return step, err
+	}
+	desired, err := license.Decode(string(key))
+	if err != nil {
+		return step, err
+	}
+	step.to = desired.ExpiresAt.Format(time.DateOnly)
+
+	client, _, err := newKubeClient()
+	if err != nil {
+		return step, err
+	}
+	if current, err := license.Load(ctx, client, apply.manager.Namespace()); err == nil {
+		step.from = current.ExpiresAt.Format(time.DateOnly)
+		if sameLicense(current, desired) {
+			step.action = planUnchanged
+		}
+	}
+	return step, nil
+}
+
+func (apply *ApplyConfig) execute(ctx context.Context, step planAction) error {
+	switch step.action {
+	case planInstall:
+		return apply.manager.InstallRelease(ctx, step.releaseName, step.chartName, step.opts)
+	case planUpgrade:
+		return apply.manager.UpgradeRelease(ctx, step.releaseName, step.chartName, step.opts)
+	case planUninstall:
+		// only hostgroups are removed, with their autoscalers and join secret
+		hostGroup := &HostgroupConfig{manager: apply.manager, IOStreams: apply.IOStreams, logger: apply.logger}
+		return hostGroup.Uninstall(ctx, step.releaseName)
+	case planLicense:
+		client, _, err := newKubeClient()
+		if err != nil {
+			return err
+		}
+		key, err := os.ReadFile(apply.platform.License.File)
+		if err != nil {
+			return err
+		}
+		if _, err := license.Apply(ctx, client, apply.manager.Namespace(), string(key)); err != nil {
+			return err
+		}
+		forgetCachedLicense()
+		return nil
+	}
+	return nil
+}
+
+func (apply *ApplyConfig) printPlan(plan []planAction) error {
+	w := tabwriter.NewWriter(apply.Out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "ACTION\tRELEASE\tFROM\tTO")
+	for _, step := range plan {
+		from, to := step.from, step.to
+		if from == "" {
+			from = "-"
+		}
+		if to == "" || step.action == planUninstall {
+			to = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", step.action, step.releaseName, from, to)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	for _, step := range plan {
+		if len(step.kept) > 0 && step.action != planUninstall {
+			fmt.Fprintf(apply.Out, "%s keeps installed values the config does not set: %s\n", step.releaseName, strings.Join(step.kept, ", "))
+		}
+	}
+	return nil
+}
+
+// undeclaredPaths are the dotted paths of the installed values that values does not set
+func undeclaredPaths(installed map[string]interface{}, values map[string]interface{}) []string {
+	var paths []string
+	for _, path := range valuePaths(installed) {
+		if !declaresPath(values, path) {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// declaresPath reports whether values sets the dotted path, or a value above it replacing it
+func declaresPath(values map[string]interface{}, path string) bool {
+	key, rest, nested := strings.Cut(path, ".")
+	value, ok := values[key]
+	if !ok {
+		return false
+	}
+	table, isTable := value.(map[string]interface{})
+	if !nested || !isTable {
+		return true
+	}
+	return declaresPath(table, rest)
+}
+
+// sameValues compares helm values after a json round trip, so number types and empty maps line up
+func sameValues(current map[string]interface{}, desired map[string]interface{}) (bool, error) {
+	a, err := normalizeValues(current)
+	if err != nil {
+		return false, err
+	}
+	b, err := normalizeValues(desired)
+	if err != nil {
+		return false, err
+	}
+	return reflect.DeepEqual(a, b), nil
+}
+
+// normalizeValues is a deep copy of the helm values after a json round trip
+func normalizeValues(values map[string]interface{}) (map[string]interface{}, error) {
+	normalized := map[string]interface{}{}
+	if len(values) == 0 {
+		return normalized, nil
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	return normalized, json.Unmarshal(data, &normalized)
+}
@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cosmonic/kubectl-cosmo/pkg/internal/platform"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+func TestSameValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		current map[string]interface{}
+		desired map[string]interface{}
+		want    bool
+	}{
+		{name: "both empty", want: true},
+		{name: "nil and empty map", current: map[string]interface{}{}, want: true},
+		{
+			name:    "int and float numbers",
+			current: map[string]interface{}{"replicas": float64(3)},
+			desired: map[string]interface{}{"replicas": 3},
+			want:    true,
+		},
+		{
+			name:    "nested maps",
+			current: map[string]interface{}{"host": map[string]interface{}{"image": "wasmcloud"}},
+			desired: map[string]interface{}{"host": map[string]interface{}{"image": "wasmcloud"}},
+			want:    true,
+		},
+		{
+			name:    "different value",
+			current: map[string]interface{}{"replicas": 3},
+			desired: map[string]interface{}{"replicas": 2},
+		},
+		{
+			name:    "value removed",
+			current: map[string]interface{}{"replicas": 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sameValues(tt.current, tt.desired)
+			if err != nil {
+				t.Fatalf("sameValues() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("sameValues() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffRelease(t *testing.T) {
+	installed := func(version string, values map[string]interface{}) *release.Release {
+		return &release.Release{Chart: &chart.Chart{Metadata: &chart.Metadata{Version: version}}, Config: values}
+	}
+
+	tests := []struct {
+		name       string
+		rel        *release.Release
+		to         string
+		values     map[string]interface{}
+		wantAction string
+		wantFrom   string
+		wantKept   []string
+	}{
+		{
+			name:       "not installed",
+			to:         "0.2.0",
+			wantAction: planInstall,
+		},
+		{
+			name:       "same version and values",
+			rel:        installed("0.2.0", map[string]interface{}{"replicas": float64(2)}),
+			to:         "0.2.0",
+			values:     map[string]interface{}{"replicas": 2},
+			wantAction: planUnchanged,
+			wantFrom:   "0.2.0",
+		},
+		{
+			name:       "new version",
+			rel:        installed("0.1.0", nil),
+			to:         "0.2.0",
+			wantAction: planUpgrade,
+			wantFrom:   "0.1.0",
+		},
+		{
+			name:       "new values",
+			rel:        installed("0.2.0", nil),
+			to:         "0.2.0",
+			values:     map[string]interface{}{"replicas": 2},
+			wantAction: planUpgrade,
+			wantFrom:   "0.2.0",
+		},
+		{
+			name: "join values kept",
+			rel: installed("0.2.0", map[string]interface{}{
+				"replicas": float64(2),
+				"join":     map[string]interface{}{"endpoint": "nexus.example.com:4222"},
+			}),
+			to:         "0.2.0",
+			values:     map[string]interface{}{"replicas": 2},
+			wantAction: planUnchanged,
+			wantFrom:   "0.2.0",
+			wantKept:   []string{"join.endpoint"},
+		},
+		{
+			name:       "value replaced by the config",
+			rel:        installed("0.2.0", map[string]interface{}{"resources": map[string]interface{}{"cpu": "1"}}),
+			to:         "0.2.0",
+			values:     map[string]interface{}{"resources": nil},
+			wantAction: planUpgrade,
+			wantFrom:   "0.2.0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step := planAction{to: tt.to}
+			if err := diffRelease(&step, tt.rel, tt.values); err != nil {
+				t.Fatalf("diffRelease() error = %v", err)
+			}
+			if step.action != tt.wantAction || step.from != tt.wantFrom {
+				t.Errorf("diffRelease() = %s from %q, want %s from %q", step.action, step.from, tt.wantAction, tt.wantFrom)
+			}
+			if !reflect.DeepEqual(step.kept, tt.wantKept) {
+				t.Errorf("diffRelease() kept %v, want %v", step.kept, tt.wantKept)
+			}
+			if tt.rel != nil {
+				for _, path := range tt.wantKept {
+					if !declaresPath(step.opts.Values, path) {
+						t.Errorf("diffRelease() upgrade values drop %s", path)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestPlanRemovals(t *testing.T) {
+	hostgroups := []platform.Hostgroup{{Name: "hostgroup"}, {Name: "gpu"}}
+
+	tests := []struct {
+		name      string
+		installed []string
+		want      []string
+	}{
+		{name: "nothing installed"},
+		{name: "all declared", installed: []string{"gpu", "hostgroup"}},
+		{name: "undeclared removed", installed: []string{"edge", "hostgroup", "old"}, want: []string{"edge", "old"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, step := range planRemovals(tt.installed, hostgroups) {
+				if step.action != planUninstall || step.chartName != hostgroupRepoChartName {
+					t.Errorf("planRemovals() step = %+v, want an uninstall of %s", step, hostgroupRepoChartName)
+				}
+				got = append(got, step.releaseName)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("planRemovals() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,388 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/homedir"
+)
+
+const (
+	// connectHost is where the NATS tunnel listens, wash is pointed at it
+	connectHost = "127.0.0.1"
+	// washContextsDir is the directory under the wash dir holding its contexts
+	washContextsDir = "contexts"
+)
+
+// invalidContextChars are replaced in the generated wash context name
+var invalidContextChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// natsCredentials are the NATS credentials read from the cluster, either a creds file or a jwt and seed
+type natsCredentials struct {
+	secret string
+	creds  []byte
+	jwt    string
+	seed   string
+}
+
+// washContext is the context file format of the wasmCloud CLI
+type washContext struct {
+	Name         string `json:"name"`
+	Lattice      string `json:"lattice"`
+	CtlHost      string `json:"ctl_host"`
+	CtlPort      int    `json:"ctl_port"`
+	CtlCredsFile string `json:"ctl_credsfile,omitempty"`
+	CtlJWT       string `json:"ctl_jwt,omitempty"`
+	CtlSeed      string `json:"ctl_seed,omitempty"`
+	CtlTimeout   int    `json:"ctl_timeout"`
+	RPCHost      string `json:"rpc_host"`
+	RPCPort      int    `json:"rpc_port"`
+	RPCCredsFile string `json:"rpc_credsfile,omitempty"`
+	RPCJWT       string `json:"rpc_jwt,omitempty"`
+	RPCSeed      string `json:"rpc_seed,omitempty"`
+	RPCTimeout   int    `json:"rpc_timeout"`
+}
+
+type ConnectConfig struct {
+	configFlags *genericclioptions.ConfigFlags
+	localPort   int
+	secret      string
+	lattice     string
+	contextName string
+	washDir     string
+	exec        bool
+	command     []string
+	genericiooptions.IOStreams
+}
+
+func NewCmdConnect(streams genericiooptions.IOStreams) *cobra.Command {
+	connect := &ConnectConfig{configFlags: genericclioptions.NewConfigFlags(true), IOStreams: streams}
+
+	cmd := &cobra.Command{
+		Use:   "connect [--exec -- command [args...]] [flags]",
+		Short: "Connect local wasmCloud tooling to the platform's NATS",
+		Long: `Open a port-forward to the platform's NATS endpoint, read its credentials from the cluster and
+write a wash context pointing at the tunnel. The tunnel stays open until interrupted.
+
+With --exec the command is run with the NATS and wasmCloud environment variables set, and the
+tunnel is closed when it exits.
+
+The credentials are read from the --secret secret, else from the secret labeled
+cosmonic.io/nats-credentials=true in the install namespace, else from the only secret holding a
+.creds key. When several secrets qualify the command fails rather than picking one.`,
+		Example: `  # keep a tunnel open for wash, in another terminal: wash ctx use <context>
+  kubectl cosmo connect
+
+  # run a single command against the platform
+  kubectl cosmo connect --exec -- wash get inventory`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := connect.Complete(cmd, args); err != nil {
+				return err
+			}
+			if err := connect.Validate(); err != nil {
+				return err
+			}
+
+			return connect.Run()
+		},
+	}
+
+	cmd.Flags().IntVar(&connect.localPort, "port", -1, "local port of the NATS tunnel (default the NATS port when free, otherwise a free port)")
+	cmd.Flags().StringVar(&connect.secret, "secret", "", fmt.Sprintf("secret in %s holding the NATS credentials (default the secret labeled %s=true, or the only secret with a .creds key)", cosmonicNamespace, natsCredentialsLabel))
+	cmd.Flags().StringVar(&connect.lattice, "lattice", "default", "wasmCloud lattice to connect to")
+	cmd.Flags().StringVar(&connect.contextName, "context-name", "", "name of the wash context to write (default derived from the kubeconfig context)")
+	cmd.Flags().StringVar(&connect.washDir, "wash-dir", filepath.Join(homedir.HomeDir(), ".wash"), "wash configuration directory the context is written to")
+	cmd.Flags().BoolVar(&connect.exec, "exec", false, "run the command after -- with the connection environment, then close the tunnel")
+
+	return cmd
+}
+
+// Complete sets the command to run and the default context name
+func (connect *ConnectConfig) Complete(cmd *cobra.Command, args []string) error {
+	connect.command = args
+
+	if connect.contextName == "" {
+		rawConfig, err := connect.configFlags.ToRawKubeConfigLoader().RawConfig()
+		if err != nil {
+			return err
+		}
+		if rawConfig.CurrentContext == "" {
+			return errNoContext
+		}
+		connect.contextName = "cosmo-" + strings.Trim(invalidContextChars.ReplaceAllString(rawConfig.CurrentContext, "-"), "-")
+	}
+	return nil
+}
+
+// Validate checks that a command is given exactly when --exec is
+func (connect *ConnectConfig) Validate() error {
+	if connect.exec && len(connect.command) == 0 {
+		return errors.New("--exec needs a command after --")
+	}
+	if !connect.exec && len(connect.command) > 0 {
+		return fmt.Errorf("unexpected arguments %q, use --exec to run a command", connect.command)
+	}
+	if connect.localPort < -1 || connect.localPort > 65535 {
+		return fmt.Errorf("invalid --port %d", connect.localPort)
+	}
+	return nil
+}
+
+// Run opens the tunnel, writes the wash context and waits for an interrupt or the command to exit
+func (connect *ConnectConfig) Run() error {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	client, config, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+
+	target, err := resolvePortForward(ctx, client, "nats", nil)
+	if err != nil {
+		return err
+	}
+	target.ports[0].local = connect.natsLocalPort(target.ports[0].local)
+
+	credentials, err := natsCredentialsFromSecret(ctx, client, connect.secret)
+	if err != nil {
+		return err
+	}
+	if credentials == nil {
+		fmt.Fprintln(connect.ErrOut, "No NATS credentials found, connecting without credentials")
+	} else {
+		fmt.Fprintf(connect.ErrOut, "Using the NATS credentials in secret %s\n", credentials.secret)
+	}
+
+	forwarder := &podForwarder{
+		client:    client,
+		config:    config,
+		namespace: cosmonicNamespace,
+		selector:  target.selector,
+		name:      target.service,
+		address:   connectHost,
+		ports:     target.ports[:1],
+		out:       connect.ErrOut,
+		status:    connect.ErrOut,
+	}
+
+	readyCh := make(chan struct{})
+	stopCh := make(chan struct{}, 1)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- forwarder.Run(ctx, readyCh, stopCh)
+	}()
+
+	select {
+	case <-readyCh:
+	case err := <-errChan:
+		return err
+	}
+
+	// a kernel assigned port is only known once the tunnel is up
+	port := forwarder.ports[0].local
+	washCtx, env, err := connect.writeContext(port, credentials)
+	if err != nil {
+		stopCh <- struct{}{}
+		<-errChan
+		return err
+	}
+
+	if !connect.exec {
+		fmt.Fprintf(connect.Out, "NATS available at nats://%s\n", net.JoinHostPort(connectHost, strconv.Itoa(port)))
+		fmt.Fprintf(connect.Out, "Wrote wash context %s, select it with: wash ctx use %s\n", washCtx, connect.contextName)
+		fmt.Fprintln(connect.Out, "Ctrl+C when finished")
+		return <-errChan
+	}
+
+	child := exec.CommandContext(ctx, connect.command[0], connect.command[1:]...)
+	child.Stdin = connect.In
+	child.Stdout = connect.Out
+	child.Stderr = connect.ErrOut
+	child.Env = append(os.Environ(), env...)
+	runErr := child.Run()
+
+	stopCh <- struct{}{}
+	if err := <-errChan; err != nil {
+		return err
+	}
+	if runErr != nil {
+		return fmt.Errorf("%s: %w", connect.command[0], runErr)
+	}
+	return nil
+}
+
+// natsLocalPort keeps the NATS port locally when it is free, unless --port asks for another
+func (connect *ConnectConfig) natsLocalPort(servicePort int) int {
+	if connect.localPort >= 0 {
+		return connect.localPort
+	}
+	listener, err := net.Listen("tcp", net.JoinHostPort(connectHost, strconv.Itoa(servicePort)))
+	if err != nil {
+		return 0
+	}
+	listener.Close()
+	return servicePort
+}
+
+// writeContext writes the credentials and the wash context next to each other, returning the context
+// file and the environment a child command needs to reach the tunnel
+func (connect *ConnectConfig) writeContext(port int, credentials *natsCredentials) (string, []string, error) {
+	dir := filepath.Join(connect.washDir, washContextsDir)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", nil, err
+	}
+
+	washCtx := washContext{
+		Name:       connect.contextName,
+		Lattice:    connect.lattice,
+		CtlHost:    connectHost,
+		CtlPort:    port,
+		CtlTimeout: 2000,
+		RPCHost:    connectHost,
+		RPCPort:    port,
+		RPCTimeout: 2000,
+	}
+	env := []string{
+		fmt.Sprintf("NATS_URL=nats://%s", net.JoinHostPort(connectHost, strconv.Itoa(port))),
+		"WASMCLOUD_CTL_HOST=" + connectHost,
+		"WASMCLOUD_CTL_PORT=" + strconv.Itoa(port),
+		"WASMCLOUD_RPC_HOST=" + connectHost,
+		"WASMCLOUD_RPC_PORT=" + strconv.Itoa(port),
+		"WASMCLOUD_LATTICE=" + connect.lattice,
+	}
+
+	if credentials != nil {
+		if len(credentials.creds) > 0 {
+			credsFile := filepath.Join(dir, connect.contextName+".creds")
+			if err := os.WriteFile(credsFile, credentials.creds, 0o600); err != nil {
+				return "", nil, err
+			}
+			washCtx.CtlCredsFile = credsFile
+			washCtx.RPCCredsFile = credsFile
+			env = append(env, "NATS_CREDS="+credsFile, "WASMCLOUD_CTL_CREDSFILE="+credsFile, "WASMCLOUD_RPC_CREDSFILE="+credsFile)
+		} else {
+			washCtx.CtlJWT, washCtx.CtlSeed = credentials.jwt, credentials.seed
+			washCtx.RPCJWT, washCtx.RPCSeed = credentials.jwt, credentials.seed
+			env = append(env, "WASMCLOUD_CTL_JWT="+credentials.jwt, "WASMCLOUD_CTL_SEED="+credentials.seed,
+				"WASMCLOUD_RPC_JWT="+credentials.jwt, "WASMCLOUD_RPC_SEED="+credentials.seed)
+		}
+	}
+
+	data, err := json.MarshalIndent(washCtx, "", "  ")
+	if err != nil {
+		return "", nil, err
+	}
+	contextFile := filepath.Join(dir, connect.contextName+".json")
+	if err := os.WriteFile(contextFile, data, 0o600); err != nil {
+		return "", nil, err
+	}
+
+	return contextFile, env, nil
+}
+
+// natsCredentialsLabel marks the secret in the install namespace holding the NATS credentials the
+// CLI connects with when no --secret is given
+const natsCredentialsLabel = "cosmonic.io/nats-credentials"
+
+// natsCredentialsFromSecret reads the NATS credentials from the named secret, or else from the secret
+// in the install namespace labeled cosmonic.io/nats-credentials=true. Without a labeled secret the
+// only secret with a .creds key is used. Several candidates are an error so credentials are never
+// guessed, and no credentials are returned when the platform has none.
+func natsCredentialsFromSecret(ctx context.Context, client kubernetes.Interface, name string) (*natsCredentials, error) {
+	if name != "" {
+		secret, err := client.CoreV1().Secrets(cosmonicNamespace).Get(ctx, name, v1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		credentials := credentialsFromSecret(secret)
+		if credentials == nil {
+			return nil, fmt.Errorf("secret %s has no .creds key or jwt and seed keys", name)
+		}
+		return credentials, nil
+	}
+
+	labeled, err := client.CoreV1().Secrets(cosmonicNamespace).List(ctx, v1.ListOptions{LabelSelector: natsCredentialsLabel + "=true"})
+	if err != nil {
+		return nil, err
+	}
+	switch len(labeled.Items) {
+	case 0:
+	case 1:
+		credentials := credentialsFromSecret(&labeled.Items[0])
+		if credentials == nil {
+			return nil, fmt.Errorf("secret %s has no .creds key or jwt and seed keys", labeled.Items[0].Name)
+		}
+		return credentials, nil
+	default:
+		return nil, fmt.Errorf("several secrets are labeled %s=true: %s, pass --secret", natsCredentialsLabel, strings.Join(secretNames(labeled.Items), ", "))
+	}
+
+	secrets, err := client.CoreV1().Secrets(cosmonicNamespace).List(ctx, v1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []*natsCredentials
+	var names []string
+	for i := range secrets.Items {
+		if credentials := credentialsFromSecret(&secrets.Items[i]); credentials != nil && len(credentials.creds) > 0 {
+			candidates = append(candidates, credentials)
+			names = append(names, credentials.secret)
+		}
+	}
+	if len(candidates) > 1 {
+		sort.Strings(names)
+		return nil, fmt.Errorf("several secrets hold NATS credentials: %s, pass --secret or label one %s=true", strings.Join(names, ", "), natsCredentialsLabel)
+	}
+	if len(candidates) == 1 {
+		return candidates[0], nil
+	}
+	return nil, nil
+}
+
+// secretNames are the sorted names of the secrets
+func secretNames(secrets []corev1.Secret) []string {
+	names := make([]string, 0, len(secrets))
+	for _, secret := range secrets {
+		names = append(names, secret.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func credentialsFromSecret(secret *corev1.Secret) *natsCredentials {
+	keys := make([]string, 0, len(secret.Data))
+	for key := range secret.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if strings.HasSuffix(key, ".creds") || key == "creds" {
+			return &natsCredentials{secret: secret.Name, creds: secret.Data[key]}
+		}
+	}
+	if jwt, seed := secret.Data["jwt"], secret.Data["seed"]; len(jwt) > 0 && len(seed) > 0 {
+		return &natsCredentials{secret: secret.Name, jwt: string(jwt), seed: string(seed)}
+	}
+	return nil
+}
@@ -5,25 +5,24 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"io"
 	"net"
-	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
 
 	"github.com/pkg/browser"
 	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/cli-runtime/pkg/genericiooptions"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd/api"
-	"k8s.io/client-go/tools/portforward"
-	"k8s.io/client-go/transport/spdy"
-
-	"k8s.io/client-go/tools/clientcmd"
 )
 
 const (
@@ -31,8 +30,12 @@ const (
 	startPort = 8080
 	endPort   = 8280
 
+	// defaultConsolePort is used when the console service and container do not expose a port
+	defaultConsolePort = 8080
+
 	cosmonicNamespace = "cosmonic-system"
 	consoleDeployment = "console"
+	consoleService    = "console"
 )
 
 var (
@@ -49,6 +52,14 @@ type ConsoleConfig struct {
 	userSpecifiedContext  string
 	userSpecifiedAuthInfo string
 	genericiooptions.IOStreams
+
+	localPort    int
+	localPortSet bool
+	address      string
+	remotePort   int
+	noBrowser    bool
+	detach       bool
+	portForward  bool
 }
 
 func NewCmdConsole(streams genericiooptions.IOStreams) *cobra.Command {
@@ -73,12 +84,26 @@ func NewCmdConsole(streams genericiooptions.IOStreams) *cobra.Command {
 		},
 	}
 
+	cmd.Flags().IntVar(&console.localPort, "port", startPort, fmt.Sprintf("local port to listen on, 0 for an ephemeral port; when unset the first free port up to %d is used", endPort))
+	cmd.Flags().StringVar(&console.address, "address", "localhost", "local address to bind the port-forward to")
+	cmd.Flags().IntVar(&console.remotePort, "remote-port", 0, "console port to forward to (default the port exposed by the console service or container)")
+	cmd.Flags().BoolVar(&console.noBrowser, "no-browser", false, "print the console URL instead of prompting to open a browser")
+	cmd.Flags().BoolVar(&console.detach, "detach", false, "run the port-forward in the background and return once it is ready")
+	cmd.Flags().BoolVar(&console.portForward, "port-forward", false, "port-forward to the console even when it has been exposed")
+
+	// add subcommands
+	cmd.AddCommand(newCmdConsoleList(console))
+	cmd.AddCommand(newCmdConsoleStop(console))
+	cmd.AddCommand(newCmdConsoleExpose(console))
+	cmd.AddCommand(newCmdConsoleUnexpose(console))
+
 	return cmd
 }
 
 // Complete sets the k8s context etc.
 func (c *ConsoleConfig) Complete(cmd *cobra.Command, args []string) error {
 	c.args = args
+	c.localPortSet = cmd.Flags().Changed("port")
 
 	var err error
 	c.rawConfig, err = c.configFlags.ToRawKubeConfigLoader().RawConfig()
@@ -139,6 +164,13 @@ func (c *ConsoleConfig) Validate() error {
 		return errNoContext
 	}
 
+	if c.localPort < 0 || c.localPort > 65535 {
+		return fmt.Errorf("invalid --port %d", c.localPort)
+	}
+	if c.remotePort < 0 || c.remotePort > 65535 {
+		return fmt.Errorf("invalid --remote-port %d", c.remotePort)
+	}
+
 	// verify that the console deployment is running
 	hasConsole, err := c.verifyConsoleDeployment()
 
@@ -155,7 +187,14 @@ func (c *ConsoleConfig) Validate() error {
 
 // Run will create the Forward proxy and launch the URL to the port
 func (c *ConsoleConfig) Run() error {
-	ctx := context.Background()
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	if !c.portForward && !c.detach {
+		if opened, err := c.openExposedConsole(ctx); opened || err != nil {
+			return err
+		}
+	}
 
 	// get localPort available
 	localPort, err := c.findLocalPort()
@@ -163,33 +202,86 @@ func (c *ConsoleConfig) Run() error {
 		return err
 	}
 
+	if c.detach {
+		return c.runDetached(ctx, localPort)
+	}
+
+	if c.remotePort == 0 {
+		c.remotePort, err = c.consoleRemotePort(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
 	readyCh := make(chan struct{})
 	stopCh := make(chan struct{}, 1)
-	errChan := make(chan error)
+	errChan := make(chan error, 1)
 
 	go func() {
 		errChan <- c.PortForward(ctx, readyCh, stopCh, errChan, localPort)
 	}()
 
+	consoleURL := fmt.Sprintf("http://%s", net.JoinHostPort(c.urlHost(), strconv.Itoa(localPort)))
+
 	select {
 	case <-readyCh:
+		if c.noBrowser {
+			fmt.Fprintf(c.Out, "Console available at %s\nCtrl+C when finished\n", consoleURL)
+			return <-errChan
+		}
 		// Display message to "press enter" to open console, Control+C when finished
-		fmt.Printf("Press enter to connect to the console at http://localhost:%d\nCtrl+C when finished\n", localPort)
+		fmt.Fprintf(c.Out, "Press enter to connect to the console at %s\nCtrl+C when finished\n", consoleURL)
 	case err = <-errChan:
-		fmt.Printf("Error with starting port forwarding, error %v", err)
+		fmt.Fprintf(c.ErrOut, "Error with starting port forwarding, error %v\n", err)
 		return err
 	}
 
-	reader := bufio.NewReader(os.Stdin)
+	// Wait until the newline character is read, without blocking shutdown on stdin
+	enterCh := make(chan struct{})
+	go func() {
+		bufio.NewReader(c.In).ReadBytes('\n')
+		close(enterCh)
+	}()
 
-	// Wait until the newline character is read
-	reader.ReadBytes('\n')
-	browser.OpenURL(fmt.Sprintf("http://localhost:%d", localPort))
+	select {
+	case <-enterCh:
+		browser.OpenURL(consoleURL)
+	case err = <-errChan:
+		return err
+	}
 
 	// pause until user breaks out
-	select {}
+	return <-errChan
 }
 
+// openExposedConsole opens the URL of the console when it has been exposed, reporting whether it was
+func (c *ConsoleConfig) openExposedConsole(ctx context.Context) (bool, error) {
+	client, _, err := c.k8sClient()
+	if err != nil {
+		return false, err
+	}
+	dynamicClient, err := newDynamicClient()
+	if err != nil {
+		return false, err
+	}
+
+	consoleURL := exposedConsoleURL(ctx, client, dynamicClient)
+	if consoleURL == "" {
+		return false, nil
+	}
+
+	if c.noBrowser {
+		fmt.Fprintf(c.Out, "Console available at %s\n", consoleURL)
+		return true, nil
+	}
+
+	fmt.Fprintf(c.Out, "Opening the console at %s\n", consoleURL)
+	return true, browser.OpenURL(consoleURL)
+}
+
+// PortForward forwards localPort to a ready console pod, reconnecting to another ready pod whenever
+// the current one goes away. readyCh is closed the first time the tunnel is up, and it returns nil
+// once ctx is cancelled or stopCh is signalled.
 func (c *ConsoleConfig) PortForward(ctx context.Context, readyCh chan struct{}, stopCh chan struct{}, errChan chan error, localPort int) error {
 	if ctx.Err() != nil {
 		return fmt.Errorf("context is already closed")
@@ -204,51 +296,51 @@ func (c *ConsoleConfig) PortForward(ctx context.Context, readyCh chan struct{},
 		return err
 	}
 
-	podList, err := client.CoreV1().Pods(cosmonicNamespace).List(ctx, v1.ListOptions{
-		LabelSelector: labels.Set(consoleDeploy.Spec.Selector.MatchLabels).AsSelector().String(),
-	})
-
+	selector, err := v1.LabelSelectorAsSelector(consoleDeploy.Spec.Selector)
 	if err != nil {
 		return err
 	}
 
-	if len(podList.Items) == 0 {
-		return errors.New("no pod found for console deployment")
+	forwarder := &podForwarder{
+		client:    client,
+		config:    config,
+		namespace: cosmonicNamespace,
+		selector:  selector,
+		name:      "console",
+		address:   c.address,
+		ports:     []forwardPort{{local: localPort, remote: intstr.FromInt(c.remotePort)}},
+		out:       io.Discard,
+		status:    c.ErrOut,
 	}
+	return forwarder.Run(ctx, readyCh, stopCh)
+}
 
-	hostIP := strings.TrimLeft(config.Host, "htps:/")
-
-	log.Printf("hostIP is %s", hostIP)
-
-	transport, upgrader, err := spdy.RoundTripperFor(config)
-
-	if err != nil {
-		return err
+func isPodReady(pod *corev1.Pod) bool {
+	if pod.DeletionTimestamp != nil || pod.Status.Phase != corev1.PodRunning {
+		return false
 	}
-
-	podPath := client.CoreV1().RESTClient().Post().Resource("pods").Namespace(cosmonicNamespace).Name(podList.Items[0].Name).SubResource("portforward")
-
-	dialer := spdy.NewDialer(
-		upgrader,
-		&http.Client{Transport: transport},
-		http.MethodPost,
-		podPath.URL(),
-	)
-
-	iostream := genericclioptions.IOStreams{Out: os.Stdout, ErrOut: os.Stderr}
-
-	portForwarder, err := portforward.New(dialer, []string{fmt.Sprintf("%d:%d", localPort, 8080)}, stopCh, readyCh, iostream.Out, iostream.ErrOut)
-	if err != nil {
-		return err
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
 	}
-
-	return portForwarder.ForwardPorts()
+	return false
 }
 
+// findLocalPort returns the --port if one was given, a kernel assigned port for 0,
+// or else the first available port in the startPort to endPort range
 func (c *ConsoleConfig) findLocalPort() (int, error) {
+	if c.localPortSet {
+		listener, err := net.Listen("tcp", net.JoinHostPort(c.address, strconv.Itoa(c.localPort)))
+		if err != nil {
+			return 0, fmt.Errorf("local port %d is not available: %w", c.localPort, err)
+		}
+		defer listener.Close()
+		return listener.Addr().(*net.TCPAddr).Port, nil
+	}
 
 	for portNum := startPort; portNum <= endPort; portNum++ {
-		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", portNum))
+		listener, err := net.Listen("tcp", net.JoinHostPort(c.address, strconv.Itoa(portNum)))
 		if err == nil {
 			listener.Close()
 			return portNum, err
@@ -257,23 +349,58 @@ func (c *ConsoleConfig) findLocalPort() (int, error) {
 	return 0, errors.New("local port for port-forwarding not found")
 }
 
-func (c *ConsoleConfig) k8sClient() (*kubernetes.Clientset, *rest.Config, error) {
-	rules := clientcmd.NewDefaultClientConfigLoadingRules()
-	overrides := &clientcmd.ConfigOverrides{}
-
-	kubeConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+// urlHost is the host to use in the console URL for the bound address
+func (c *ConsoleConfig) urlHost() string {
+	if c.address == "" || c.address == "0.0.0.0" || c.address == "::" {
+		return "localhost"
+	}
+	return c.address
+}
 
-	config, err := kubeConfig.ClientConfig()
+// consoleRemotePort resolves the port the console listens on, from the target port of the console
+// service, falling back to the first port of the console container
+func (c *ConsoleConfig) consoleRemotePort(ctx context.Context) (int, error) {
+	client, _, err := c.k8sClient()
 	if err != nil {
-		return nil, nil, err
+		return 0, err
 	}
 
-	client, err := kubernetes.NewForConfig(config)
+	deploy, err := client.AppsV1().Deployments(cosmonicNamespace).Get(ctx, consoleDeployment, v1.GetOptions{})
 	if err != nil {
-		return nil, nil, err
+		return 0, err
+	}
+	containers := deploy.Spec.Template.Spec.Containers
+
+	svc, err := client.CoreV1().Services(cosmonicNamespace).Get(ctx, consoleService, v1.GetOptions{})
+	if err == nil && len(svc.Spec.Ports) > 0 {
+		target := svc.Spec.Ports[0].TargetPort
+		if target.Type == intstr.Int && target.IntVal > 0 {
+			return int(target.IntVal), nil
+		}
+		// a named target port refers to a container port
+		if target.Type == intstr.String {
+			for _, container := range containers {
+				for _, port := range container.Ports {
+					if port.Name == target.StrVal {
+						return int(port.ContainerPort), nil
+					}
+				}
+			}
+		}
+		return int(svc.Spec.Ports[0].Port), nil
 	}
 
-	return client, config, nil
+	for _, container := range containers {
+		if len(container.Ports) > 0 {
+			return int(container.Ports[0].ContainerPort), nil
+		}
+	}
+
+	return defaultConsolePort, nil
+}
+
+func (c *ConsoleConfig) k8sClient() (*kubernetes.Clientset, *rest.Config, error) {
+	return newKubeClient()
 }
 
 func (c *ConsoleConfig) verifyConsoleDeployment() (bool, error) {
@@ -0,0 +1,302 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	consoleExposeName = "console"
+	managedByLabel    = "app.kubernetes.io/managed-by"
+	managedByValue    = "kubectl-cosmo"
+
+	exposeTypeAuto      = "auto"
+	exposeTypeIngress   = "ingress"
+	exposeTypeHTTPRoute = "httproute"
+)
+
+var httpRouteResource = schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "httproutes"}
+
+type consoleExposeOptions struct {
+	host       string
+	tlsSecret  string
+	class      string
+	exposeType string
+}
+
+func newCmdConsoleExpose(console *ConsoleConfig) *cobra.Command {
+	opts := &consoleExposeOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "expose --host <fqdn> [flags]",
+		Short: "expose the console through an Ingress, or a Gateway API HTTPRoute when available",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, _, err := console.k8sClient()
+			if err != nil {
+				return err
+			}
+			dynamicClient, err := newDynamicClient()
+			if err != nil {
+				return err
+			}
+
+			url, err := exposeConsole(context.Background(), client, dynamicClient, opts)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(console.Out, "Console exposed at %s\n", url)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.host, "host", "", "fully qualified host name to serve the console on")
+	cmd.Flags().StringVar(&opts.tlsSecret, "tls-secret", "", "secret holding the TLS certificate for the host (Ingress only)")
+	cmd.Flags().StringVar(&opts.class, "class", "", "ingress class name, or the parent gateway as [namespace/]name for an HTTPRoute")
+	cmd.Flags().StringVar(&opts.exposeType, "type", exposeTypeAuto, "resource to create: ingress or httproute, or auto for an HTTPRoute when --class names a gateway rather than an ingress class")
+	cmd.MarkFlagRequired("host")
+
+	return cmd
+}
+
+func newCmdConsoleUnexpose(console *ConsoleConfig) *cobra.Command {
+	return &cobra.Command{
+		Use:   "unexpose",
+		Short: "remove the Ingress or HTTPRoute created by console expose",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, _, err := console.k8sClient()
+			if err != nil {
+				return err
+			}
+			dynamicClient, err := newDynamicClient()
+			if err != nil {
+				return err
+			}
+
+			removed, err := unexposeConsole(context.Background(), client, dynamicClient)
+			if err != nil {
+				return err
+			}
+			if !removed {
+				fmt.Fprintln(console.Out, "console is not exposed")
+				return nil
+			}
+
+			fmt.Fprintln(console.Out, "console is no longer exposed")
+			return nil
+		},
+	}
+}
+
+// exposeConsole creates or updates the route to the console service and returns its URL
+func exposeConsole(ctx context.Context, client kubernetes.Interface, dynamicClient dynamic.Interface, opts *consoleExposeOptions) (string, error) {
+	svc, err := client.CoreV1().Services(cosmonicNamespace).Get(ctx, consoleService, v1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get the console service: %w", err)
+	}
+	if len(svc.Spec.Ports) == 0 {
+		return "", fmt.Errorf("console service does not expose any ports")
+	}
+	servicePort := svc.Spec.Ports[0].Port
+
+	exposeType := opts.exposeType
+	if exposeType == exposeTypeAuto {
+		// an HTTPRoute needs its parent gateway named by --class, TLS is only set up on an Ingress
+		exposeType = exposeTypeIngress
+		if hasResource(client, httpRouteResource.GroupVersion().String(), httpRouteResource.Resource) && opts.tlsSecret == "" && opts.class != "" {
+			_, err := client.NetworkingV1().IngressClasses().Get(ctx, opts.class, v1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				exposeType = exposeTypeHTTPRoute
+			} else if err != nil {
+				return "", err
+			}
+		}
+	}
+
+	switch exposeType {
+	case exposeTypeIngress:
+		if err := applyConsoleIngress(ctx, client, opts, servicePort); err != nil {
+			return "", err
+		}
+		if opts.tlsSecret != "" {
+			return "https://" + opts.host, nil
+		}
+		return "http://" + opts.host, nil
+	case exposeTypeHTTPRoute:
+		if opts.tlsSecret != "" {
+			return "", fmt.Errorf("--tls-secret is not supported for an HTTPRoute, configure TLS on the gateway listener")
+		}
+		if opts.class == "" {
+			return "", fmt.Errorf("--class must name the parent gateway for an HTTPRoute")
+		}
+		if err := applyConsoleHTTPRoute(ctx, dynamicClient, opts, servicePort); err != nil {
+			return "", err
+		}
+		return "http://" + opts.host, nil
+	default:
+		return "", fmt.Errorf("unknown --type %q, must be one of %s, %s or %s", opts.exposeType, exposeTypeAuto, exposeTypeIngress, exposeTypeHTTPRoute)
+	}
+}
+
+func applyConsoleIngress(ctx context.Context, client kubernetes.Interface, opts *consoleExposeOptions, servicePort int32) error {
+	pathType := networkingv1.PathTypePrefix
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      consoleExposeName,
+			Namespace: cosmonicNamespace,
+			Labels:    map[string]string{managedByLabel: managedByValue},
+		},
+		Spec: networkingv1.IngressSpec{
+			Rules: []networkingv1.IngressRule{{
+				Host: opts.host,
+				IngressRuleValue: networkingv1.IngressRuleValue{
+					HTTP: &networkingv1.HTTPIngressRuleValue{
+						Paths: []networkingv1.HTTPIngressPath{{
+							Path:     "/",
+							PathType: &pathType,
+							Backend: networkingv1.IngressBackend{
+								Service: &networkingv1.IngressServiceBackend{
+									Name: consoleService,
+									Port: networkingv1.ServiceBackendPort{Number: servicePort},
+								},
+							},
+						}},
+					},
+				},
+			}},
+		},
+	}
+	if opts.class != "" {
+		ingress.Spec.IngressClassName = &opts.class
+	}
+	if opts.tlsSecret != "" {
+		ingress.Spec.TLS = []networkingv1.IngressTLS{{Hosts: []string{opts.host}, SecretName: opts.tlsSecret}}
+	}
+
+	ingresses := client.NetworkingV1().Ingresses(cosmonicNamespace)
+	existing, err := ingresses.Get(ctx, consoleExposeName, v1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = ingresses.Create(ctx, ingress, v1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if existing.Labels[managedByLabel] != managedByValue {
+		return fmt.Errorf("Ingress %s was not created by console expose, remove it first", consoleExposeName)
+	}
+
+	ingress.ResourceVersion = existing.ResourceVersion
+	_, err = ingresses.Update(ctx, ingress, v1.UpdateOptions{})
+	return err
+}
+
+func applyConsoleHTTPRoute(ctx context.Context, dynamicClient dynamic.Interface, opts *consoleExposeOptions, servicePort int32) error {
+	parent := map[string]interface{}{"name": opts.class}
+	if namespace, name, found := strings.Cut(opts.class, "/"); found {
+		parent = map[string]interface{}{"namespace": namespace, "name": name}
+	}
+
+	route := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": httpRouteResource.GroupVersion().String(),
+		"kind":       "HTTPRoute",
+		"metadata": map[string]interface{}{
+			"name":      consoleExposeName,
+			"namespace": cosmonicNamespace,
+			"labels":    map[string]interface{}{managedByLabel: managedByValue},
+		},
+		"spec": map[string]interface{}{
+			"parentRefs": []interface{}{parent},
+			"hostnames":  []interface{}{opts.host},
+			"rules": []interface{}{map[string]interface{}{
+				"backendRefs": []interface{}{map[string]interface{}{
+					"name": consoleService,
+					"port": int64(servicePort),
+				}},
+			}},
+		},
+	}}
+
+	routes := dynamicClient.Resource(httpRouteResource).Namespace(cosmonicNamespace)
+	existing, err := routes.Get(ctx, consoleExposeName, v1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = routes.Create(ctx, route, v1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if existing.GetLabels()[managedByLabel] != managedByValue {
+		return fmt.Errorf("HTTPRoute %s was not created by console expose, remove it first", consoleExposeName)
+	}
+
+	route.SetResourceVersion(existing.GetResourceVersion())
+	_, err = routes.Update(ctx, route, v1.UpdateOptions{})
+	return err
+}
+
+// unexposeConsole deletes the Ingress and HTTPRoute created by expose, reporting whether any existed
+func unexposeConsole(ctx context.Context, client kubernetes.Interface, dynamicClient dynamic.Interface) (bool, error) {
+	removed := false
+
+	ingress, err := client.NetworkingV1().Ingresses(cosmonicNamespace).Get(ctx, consoleExposeName, v1.GetOptions{})
+	if err == nil && ingress.Labels[managedByLabel] == managedByValue {
+		if err := client.NetworkingV1().Ingresses(cosmonicNamespace).Delete(ctx, consoleExposeName, v1.DeleteOptions{}); err != nil {
+			return removed, err
+		}
+		removed = true
+	} else if err != nil && !apierrors.IsNotFound(err) {
+		return removed, err
+	}
+
+	if hasResource(client, httpRouteResource.GroupVersion().String(), httpRouteResource.Resource) {
+		routes := dynamicClient.Resource(httpRouteResource).Namespace(cosmonicNamespace)
+		route, err := routes.Get(ctx, consoleExposeName, v1.GetOptions{})
+		if err == nil && route.GetLabels()[managedByLabel] == managedByValue {
+			if err := routes.Delete(ctx, consoleExposeName, v1.DeleteOptions{}); err != nil {
+				return removed, err
+			}
+			removed = true
+		} else if err != nil && !apierrors.IsNotFound(err) {
+			return removed, err
+		}
+	}
+
+	return removed, nil
+}
+
+// exposedConsoleURL returns the URL of the console when it has been exposed, or "" otherwise
+func exposedConsoleURL(ctx context.Context, client kubernetes.Interface, dynamicClient dynamic.Interface) string {
+	ingress, err := client.NetworkingV1().Ingresses(cosmonicNamespace).Get(ctx, consoleExposeName, v1.GetOptions{})
+	if err == nil && ingress.Labels[managedByLabel] == managedByValue && len(ingress.Spec.Rules) > 0 {
+		if len(ingress.Spec.TLS) > 0 {
+			return "https://" + ingress.Spec.Rules[0].Host
+		}
+		return "http://" + ingress.Spec.Rules[0].Host
+	}
+
+	if !hasResource(client, httpRouteResource.GroupVersion().String(), httpRouteResource.Resource) {
+		return ""
+	}
+	route, err := dynamicClient.Resource(httpRouteResource).Namespace(cosmonicNamespace).Get(ctx, consoleExposeName, v1.GetOptions{})
+	if err != nil || route.GetLabels()[managedByLabel] != managedByValue {
+		return ""
+	}
+	hostnames, _, _ := unstructured.NestedStringSlice(route.Object, "spec", "hostnames")
+	if len(hostnames) == 0 {
+		return ""
+	}
+	return "http://" + hostnames[0]
+}
@@ -0,0 +1,301 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+)
+
+const (
+	// consoleStateDir is the directory under the user config dir holding plugin state
+	consoleStateDir      = "kubectl-cosmo"
+	consoleSessionsFile  = "console-sessions.json"
+	detachedReadyTimeout = 60 * time.Second
+)
+
+// consoleSession is a console port-forward running in the background
+type consoleSession struct {
+	PID int `json:"pid"`
+	// ProcessStart tells the process apart from a later one reusing its pid
+	ProcessStart string    `json:"processStart,omitempty"`
+	Port         int       `json:"port"`
+	Address      string    `json:"address"`
+	Context      string    `json:"context"`
+	URL          string    `json:"url"`
+	LogFile      string    `json:"logFile"`
+	StartedAt    time.Time `json:"startedAt"`
+}
+
+func newCmdConsoleList(console *ConsoleConfig) *cobra.Command {
+	return &cobra.Command{
+		Use:         "list",
+		Annotations: map[string]string{skipLicenseCheck: "true"},
+		Short:       "list the background console sessions",
+		Args:        cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			sessions, err := loadConsoleSessions()
+			if err != nil {
+				return err
+			}
+			return printConsoleSessions(console.IOStreams, sessions)
+		},
+	}
+}
+
+func newCmdConsoleStop(console *ConsoleConfig) *cobra.Command {
+	var all bool
+
+	cmd := &cobra.Command{
+		Use:         "stop [pid...]",
+		Annotations: map[string]string{skipLicenseCheck: "true"},
+		Short:       "stop background console sessions, by default those of the current context",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			sessions, err := loadConsoleSessions()
+			if err != nil {
+				return err
+			}
+
+			pids := map[int]bool{}
+			for _, arg := range args {
+				pid, err := strconv.Atoi(arg)
+				if err != nil {
+					return fmt.Errorf("invalid pid %q", arg)
+				}
+				pids[pid] = true
+			}
+
+			currentContext := ""
+			if !all && len(pids) == 0 {
+				if err := console.Complete(cmd, args); err != nil {
+					return err
+				}
+				currentContext = console.rawConfig.CurrentContext
+			}
+
+			var remaining []consoleSession
+			stopped := 0
+			for _, session := range sessions {
+				if all || pids[session.PID] || (len(pids) == 0 && session.Context == currentContext) {
+					if session.ProcessStart == "" {
+						fmt.Fprintf(console.ErrOut, "console session %d was recorded without its process start time, stop it yourself\n", session.PID)
+						remaining = append(remaining, session)
+						continue
+					}
+					if err := stopProcess(session.PID); err != nil {
+						fmt.Fprintf(console.ErrOut, "failed to stop console session %d: %v\n", session.PID, err)
+						remaining = append(remaining, session)
+						continue
+					}
+					fmt.Fprintf(console.Out, "stopped console session %d (%s)\n", session.PID, session.URL)
+					stopped++
+					continue
+				}
+				remaining = append(remaining, session)
+			}
+
+			if stopped == 0 {
+				fmt.Fprintln(console.Out, "no console sessions stopped")
+			}
+
+			return saveConsoleSessions(remaining)
+		},
+	}
+
+	cmd.Flags().BoolVar(&all, "all", false, "stop every background console session")
+
+	return cmd
+}
+
+// runDetached starts the port-forward as a background copy of this process, waits for the
+// tunnel to accept connections and records the session
+func (c *ConsoleConfig) runDetached(ctx context.Context, localPort int) error {
+	dir, err := consoleStatePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	logFile := filepath.Join(dir, fmt.Sprintf("console-%d.log", localPort))
+	logOut, err := os.Create(logFile)
+	if err != nil {
+		return err
+	}
+	defer logOut.Close()
+
+	child := exec.Command(executable, c.detachedArgs(localPort)...)
+	child.Stdout = logOut
+	child.Stderr = logOut
+	child.SysProcAttr = detachedProcAttr()
+	if err := child.Start(); err != nil {
+		return err
+	}
+
+	exitCh := make(chan error, 1)
+	go func() {
+		exitCh <- child.Wait()
+	}()
+
+	address := net.JoinHostPort(c.urlHost(), strconv.Itoa(localPort))
+	deadline := time.NewTimer(detachedReadyTimeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+
+	for ready := false; !ready; {
+		select {
+		case <-ctx.Done():
+			stopProcess(child.Process.Pid)
+			return ctx.Err()
+		case err := <-exitCh:
+			return fmt.Errorf("console port-forward exited (%v), see %s", err, logFile)
+		case <-deadline.C:
+			stopProcess(child.Process.Pid)
+			return fmt.Errorf("timed out waiting for the console port-forward, see %s", logFile)
+		case <-ticker.C:
+			if conn, err := net.DialTimeout("tcp", address, time.Second); err == nil {
+				conn.Close()
+				ready = true
+			}
+		}
+	}
+
+	processStart, err := processStartTime(child.Process.Pid)
+	if err != nil {
+		stopProcess(child.Process.Pid)
+		return fmt.Errorf("failed to identify the console port-forward process: %w", err)
+	}
+
+	session := consoleSession{
+		PID:          child.Process.Pid,
+		ProcessStart: processStart,
+		Port:         localPort,
+		Address:      c.address,
+		Context:      c.rawConfig.CurrentContext,
+		URL:          fmt.Sprintf("http://%s", address),
+		LogFile:      logFile,
+		StartedAt:    time.Now(),
+	}
+
+	sessions, err := loadConsoleSessions()
+	if err != nil {
+		return err
+	}
+	if err := saveConsoleSessions(append(sessions, session)); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.Out, "Console available at %s (pid %d)\nUse %q to close it\n", session.URL, session.PID, "kubectl cosmo console stop")
+	return nil
+}
+
+// detachedArgs builds the command line of the background port-forward. It always forwards, an
+// exposed console would otherwise make the child print the URL and exit.
+func (c *ConsoleConfig) detachedArgs(localPort int) []string {
+	args := []string{"console", "--port-forward", "--no-browser", "--port", strconv.Itoa(localPort), "--address", c.address}
+	if c.remotePort > 0 {
+		args = append(args, "--remote-port", strconv.Itoa(c.remotePort))
+	}
+	return args
+}
+
+func consoleStatePath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, consoleStateDir), nil
+}
+
+// loadConsoleSessions reads the recorded sessions, dropping those whose process has exited
+func loadConsoleSessions() ([]consoleSession, error) {
+	dir, err := consoleStatePath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, consoleSessionsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []consoleSession
+	if err := json.Unmarshal(data, &sessions); err != nil {
+		return nil, fmt.Errorf("failed to read console sessions: %w", err)
+	}
+
+	var alive []consoleSession
+	for _, session := range sessions {
+		if session.running() {
+			alive = append(alive, session)
+		}
+	}
+	return alive, nil
+}
+
+// running tells whether the process of the session still runs. A process started at another time
+// reused the pid and is not the console.
+func (session consoleSession) running() bool {
+	if !processAlive(session.PID) {
+		return false
+	}
+	if session.ProcessStart == "" {
+		return true
+	}
+	start, err := processStartTime(session.PID)
+	return err == nil && start == session.ProcessStart
+}
+
+func saveConsoleSessions(sessions []consoleSession) error {
+	dir, err := consoleStatePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	if sessions == nil {
+		sessions = []consoleSession{}
+	}
+	data, err := json.MarshalIndent(sessions, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, consoleSessionsFile), data, 0o600)
+}
+
+func printConsoleSessions(streams genericiooptions.IOStreams, sessions []consoleSession) error {
+	if len(sessions) == 0 {
+		fmt.Fprintln(streams.Out, "no console sessions running")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(streams.Out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "PID\tCONTEXT\tURL\tAGE")
+	for _, session := range sessions {
+		age := time.Since(session.StartedAt).Round(time.Second)
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", session.PID, session.Context, session.URL, age)
+	}
+	return w.Flush()
+}
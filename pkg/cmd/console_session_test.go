@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDetachedArgs(t *testing.T) {
+	tests := []struct {
+		name       string
+		address    string
+		remotePort int
+		localPort  int
+		want       []string
+	}{
+		{
+			name:      "default remote port",
+			address:   "localhost",
+			localPort: 8080,
+			want:      []string{"console", "--port-forward", "--no-browser", "--port", "8080", "--address", "localhost"},
+		},
+		{
+			name:       "explicit remote port",
+			address:    "0.0.0.0",
+			remotePort: 3000,
+			localPort:  8081,
+			want:       []string{"console", "--port-forward", "--no-browser", "--port", "8081", "--address", "0.0.0.0", "--remote-port", "3000"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &ConsoleConfig{address: tt.address, remotePort: tt.remotePort}
+			if got := c.detachedArgs(tt.localPort); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("detachedArgs(%d) = %q, want %q", tt.localPort, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+//go:build !windows
+
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// detachedProcAttr starts the background console in its own session so it outlives the terminal
+func detachedProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
+
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// processStartTime identifies when the process started, from /proc on Linux and ps elsewhere
+func processStartTime(pid int) (string, error) {
+	if data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid)); err == nil {
+		// the command name in parentheses may hold spaces, the fields after it start at the state,
+		// the third field, and the start time is the 22nd
+		end := bytes.LastIndexByte(data, ')')
+		if fields := strings.Fields(string(data[end+1:])); end >= 0 && len(fields) > 19 {
+			return fields[19], nil
+		}
+		return "", fmt.Errorf("unexpected format of /proc/%d/stat", pid)
+	}
+
+	out, err := exec.Command("ps", "-o", "lstart=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to read the start time of process %d: %w", pid, err)
+	}
+	start := strings.TrimSpace(string(out))
+	if start == "" {
+		return "", fmt.Errorf("process %d not found", pid)
+	}
+	return start, nil
+}
+
+func stopProcess(pid int) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	err = process.Signal(syscall.SIGTERM)
+	if errors.Is(err, os.ErrProcessDone) {
+		return nil
+	}
+	return err
+}
@@ -1,15 +1,34 @@
 package cmd
 
 import (
+	"fmt"
+
 	"github.com/spf13/cobra"
 	"k8s.io/cli-runtime/pkg/genericiooptions"
 )
 
+// skipLicenseCheck annotates commands that do not talk to the cluster, or report the license
+// themselves, so they run without the license expiry round-trip
+const skipLicenseCheck = "cosmo.cosmonic.io/skip-license-check"
+
 func NewCmdCosmo(streams genericiooptions.IOStreams) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "cosmo [command] [flags]",
 		Short: "Interact with Cosmonic Control",
+		PersistentPreRun: func(c *cobra.Command, args []string) {
+			switch c.Name() {
+			case "help", "completion", cobra.ShellCompRequestCmd, cobra.ShellCompNoDescRequestCmd:
+				return
+			}
+			for parent := c; parent != nil; parent = parent.Parent() {
+				if _, ok := parent.Annotations[skipLicenseCheck]; ok {
+					return
+				}
+			}
+			warnLicenseExpiry(c, streams.ErrOut)
+		},
 	}
+	cmd.PersistentFlags().Int("license-warn-days", defaultLicenseWarnDays, fmt.Sprintf("warn when the license expires within this many days, -1 to disable (env %s)", licenseWarnDaysEnv))
 
 	// add commands
 	cmd.AddCommand(NewCmdNexus(streams))
@@ -18,5 +37,14 @@ func NewCmdCosmo(streams genericiooptions.IOStreams) *cobra.Command {
 	cmd.AddCommand(NewCmdDocs(streams))
 	cmd.AddCommand(NewCmdVersion(streams))
 	cmd.AddCommand(NewCmdLicense(streams))
+	cmd.AddCommand(NewCmdLogs(streams))
+	cmd.AddCommand(NewCmdUp(streams))
+	cmd.AddCommand(NewCmdDown(streams))
+	cmd.AddCommand(NewCmdApply(streams))
+	cmd.AddCommand(NewCmdImages(streams))
+	cmd.AddCommand(NewCmdGet(streams))
+	cmd.AddCommand(NewCmdApp(streams))
+	cmd.AddCommand(NewCmdPortForward(streams))
+	cmd.AddCommand(NewCmdConnect(streams))
 	return cmd
 }
@@ -2,7 +2,13 @@ package cmd
 
 import (
 	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
 
+	chartManager "github.com/cosmonic/kubectl-cosmo/pkg/internal/chartmanager"
 	"github.com/pkg/browser"
 	"github.com/spf13/cobra"
 	"k8s.io/cli-runtime/pkg/genericiooptions"
@@ -10,14 +16,84 @@ import (
 
 const CosmonicDocumentationURL = "https://cosmonic.com/docs"
 
+// docsTopics maps the topics accepted by the docs command to their path in the documentation
+var docsTopics = map[string]string{
+	"install":    "installation",
+	"nexus":      "nexus",
+	"hostgroup":  "hostgroups",
+	"console":    "console",
+	"license":    "licensing",
+	"components": "components",
+	"providers":  "providers",
+	"kubectl":    "kubectl-plugin",
+}
+
+type DocsConfig struct {
+	printURL bool
+	genericiooptions.IOStreams
+}
+
 func NewCmdDocs(streams genericiooptions.IOStreams) *cobra.Command {
+	docs := &DocsConfig{IOStreams: streams}
+
 	cmd := &cobra.Command{
-		Use:   "docs",
-		Short: fmt.Sprintf("Open the default browser to %s", CosmonicDocumentationURL),
+		Use:         "docs [topic]",
+		Annotations: map[string]string{skipLicenseCheck: "true"},
+		Short:       fmt.Sprintf("Open the default browser to %s", CosmonicDocumentationURL),
+		Long:        fmt.Sprintf("Open the default browser to %s, for the nexus version installed in the cluster when there is one.\n\nTopics: %s", CosmonicDocumentationURL, strings.Join(docsTopicNames(), ", ")),
+		Args:        cobra.MatchAll(cobra.MaximumNArgs(1), cobra.OnlyValidArgs),
+		ValidArgs:   docsTopicNames(),
 		RunE: func(c *cobra.Command, args []string) error {
-			return browser.OpenURL(CosmonicDocumentationURL)
+			topic := ""
+			if len(args) > 0 {
+				topic = args[0]
+			}
+
+			url := docsURL(docs.installedNexusVersion(), topic)
+			if docs.printURL {
+				_, err := fmt.Fprintln(docs.Out, url)
+				return err
+			}
+			return browser.OpenURL(url)
 		},
 	}
 
+	cmd.Flags().BoolVar(&docs.printURL, "print", false, "print the URL instead of opening a browser")
+
 	return cmd
 }
+
+func docsTopicNames() []string {
+	var names []string
+	for name := range docsTopics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// docsURL builds the documentation URL for the topic, versioned when the nexus version is known
+func docsURL(version string, topic string) string {
+	url := CosmonicDocumentationURL
+	if version != "" {
+		url = fmt.Sprintf("%s/v%s", url, strings.TrimPrefix(version, "v"))
+	}
+	if path, ok := docsTopics[topic]; ok {
+		url = fmt.Sprintf("%s/%s", url, path)
+	}
+	return url
+}
+
+// installedNexusVersion returns the nexus version in the current cluster, or "" when it can't be found
+func (docs *DocsConfig) installedNexusVersion() string {
+	manager, err := chartManager.New(docs.IOStreams, os.Getenv("HELM_DRIVER"), log.New(io.Discard, "", 0))
+	if err != nil {
+		return ""
+	}
+
+	version, err := manager.GetInstalledChartVersion(controlChartName)
+	if err != nil {
+		return ""
+	}
+	return version
+}
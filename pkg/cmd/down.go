@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	chartManager "github.com/cosmonic/kubectl-cosmo/pkg/internal/chartmanager"
+	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+	"k8s.io/client-go/kubernetes"
+)
+
+type DownConfig struct {
+	manager     *chartManager.ChartManager
+	client      kubernetes.Interface
+	configFlags *genericclioptions.ConfigFlags
+	force       bool
+	purge       bool
+	timeout     time.Duration
+	genericiooptions.IOStreams
+
+	logger *log.Logger
+}
+
+func NewCmdDown(streams genericiooptions.IOStreams) *cobra.Command {
+	down := &DownConfig{configFlags: genericclioptions.NewConfigFlags(true), IOStreams: streams, logger: log.Default()}
+
+	cmd := &cobra.Command{
+		Use:   "down --force [flags]",
+		Short: "Tear down Cosmonic Control, removing every hostgroup before the nexus",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := down.Initialize(cmd, args); err != nil {
+				return err
+			}
+
+			return down.Run(cmd.Context())
+		},
+	}
+
+	cmd.Flags().BoolVar(&down.force, "force", false, "must specify force to tear down the platform")
+	cmd.Flags().BoolVar(&down.purge, "purge", false, fmt.Sprintf("delete the %s namespace once everything is uninstalled", cosmonicNamespace))
+	cmd.Flags().DurationVar(&down.timeout, "timeout", 5*time.Minute, "how long to wait for the pods of each release to terminate")
+	cmd.MarkFlagRequired("force")
+
+	return cmd
+}
+
+// Initialize configures the chart manager and kubernetes client
+func (down *DownConfig) Initialize(cmd *cobra.Command, args []string) error {
+	helmDriver := os.Getenv("HELM_DRIVER")
+	manager, err := chartManager.New(down.IOStreams, helmDriver, log.Default())
+	if err != nil {
+		return err
+	}
+	down.manager = manager
+
+	client, _, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+	down.client = client
+
+	return nil
+}
+
+// Run uninstalls the hostgroups, waiting for their pods to go, then the nexus and optionally the namespace
+func (down *DownConfig) Run(ctx context.Context) error {
+	hostgroups, err := down.manager.ListReleases(hostgroupRepoChartName)
+	if err != nil {
+		return err
+	}
+	nexus, err := down.manager.ListReleases(controlChartName)
+	if err != nil {
+		return err
+	}
+
+	releases := append(hostgroups, nexus...)
+	steps := len(releases)
+	if down.purge {
+		steps++
+	}
+
+	// hostgroups go the way hostgroup uninstall takes them, with their autoscalers and join secret
+	hostGroup := &HostgroupConfig{manager: down.manager, IOStreams: down.IOStreams, logger: down.logger}
+
+	for i, releaseName := range releases {
+		fmt.Fprintf(down.Out, "[%d/%d] uninstalling %s\n", i+1, steps, releaseName)
+		uninstall := down.manager.UnInstall
+		if i < len(hostgroups) {
+			uninstall = func(releaseName string) error { return hostGroup.Uninstall(ctx, releaseName) }
+		}
+		if err := uninstall(releaseName); err != nil {
+			return fmt.Errorf("failed to uninstall %s: %w", releaseName, err)
+		}
+		if err := waitForReleasePods(ctx, down.client, cosmonicNamespace, releaseName, down.timeout, down.Out); err != nil {
+			return err
+		}
+	}
+
+	if down.purge {
+		fmt.Fprintf(down.Out, "[%d/%d] deleting namespace %s\n", steps, steps, cosmonicNamespace)
+		if err := down.deleteNamespace(ctx); err != nil {
+			return err
+		}
+	}
+
+	if steps == 0 {
+		fmt.Fprintln(down.Out, "Cosmonic Control is not installed")
+		return nil
+	}
+
+	fmt.Fprintln(down.Out, "Cosmonic Control is down")
+	return nil
+}
+
+func (down *DownConfig) deleteNamespace(ctx context.Context) error {
+	err := down.client.CoreV1().Namespaces().Delete(ctx, cosmonicNamespace, v1.DeleteOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return wait.PollUntilContextTimeout(ctx, 2*time.Second, down.timeout, true, func(ctx context.Context) (bool, error) {
+		_, err := down.client.CoreV1().Namespaces().Get(ctx, cosmonicNamespace, v1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	})
+}
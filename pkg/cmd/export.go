@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	chartManager "github.com/cosmonic/kubectl-cosmo/pkg/internal/chartmanager"
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	exportFormatArgoCD = "argocd"
+	exportFormatFlux   = "flux"
+
+	helmChartLayerMediaType = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+)
+
+// exportOptions configure the GitOps manifests generated for a release
+type exportOptions struct {
+	format          string
+	version         string
+	releaseName     string
+	gitopsNamespace string
+	interval        string
+}
+
+// newCmdExport builds the export subcommand for a chart, managerFn returns the initialized chart manager
+func newCmdExport(streams genericiooptions.IOStreams, component string, defaultReleaseName string, chartName string, managerFn func(cmd *cobra.Command, args []string) (*chartManager.ChartManager, error)) *cobra.Command {
+	opts := &exportOptions{}
+
+	cmd := &cobra.Command{
+		Use:         "export --format argocd|flux [flags]",
+		Annotations: map[string]string{skipLicenseCheck: "true"},
+		Short:       fmt.Sprintf("prints GitOps manifests that install the %s helm chart", component),
+		Args:        cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manager, err := managerFn(cmd, args)
+			if err != nil {
+				return err
+			}
+
+			manifests, err := exportManifests(context.Background(), manager, chartName, opts)
+			if err != nil {
+				return err
+			}
+
+			_, err = fmt.Fprint(streams.Out, manifests)
+			return err
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.format, "format", "", "manifest format, argocd for an Application or flux for a HelmRelease and OCIRepository")
+	cmd.Flags().StringVar(&opts.version, "version", "", "chart version (default the latest version in the registry)")
+	cmd.Flags().StringVar(&opts.releaseName, "release-name", defaultReleaseName, "helm release name")
+	cmd.Flags().StringVar(&opts.gitopsNamespace, "gitops-namespace", "", "namespace of the generated objects (default argocd or flux-system)")
+	cmd.Flags().StringVar(&opts.interval, "interval", "10m", "flux reconciliation interval")
+	cmd.MarkFlagRequired("format")
+	cmd.RegisterFlagCompletionFunc("format", cobra.FixedCompletions([]string{exportFormatArgoCD, exportFormatFlux}, cobra.ShellCompDirectiveNoFileComp))
+
+	return cmd
+}
+
+// exportManifests renders the multi-document YAML for the chart, using the version resolution and
+// values of ChartManager.Install
+func exportManifests(ctx context.Context, manager *chartManager.ChartManager, chartName string, opts *exportOptions) (string, error) {
+	version := opts.version
+	if version == "" {
+		var err error
+		version, err = manager.GetRepoChartVersion(ctx, chartName)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	values := manager.Values(chartManager.ReleaseOptions{Version: version})
+
+	var objects []map[string]interface{}
+	switch opts.format {
+	case exportFormatArgoCD:
+		objects = argoCDApplication(manager, chartName, version, values, opts)
+	case exportFormatFlux:
+		objects = fluxHelmRelease(manager, chartName, version, values, opts)
+	default:
+		return "", fmt.Errorf("unknown --format %q, must be %s or %s", opts.format, exportFormatArgoCD, exportFormatFlux)
+	}
+
+	var docs []string
+	for _, object := range objects {
+		data, err := yaml.Marshal(object)
+		if err != nil {
+			return "", err
+		}
+		docs = append(docs, string(data))
+	}
+	return strings.Join(docs, "---\n"), nil
+}
+
+func argoCDApplication(manager *chartManager.ChartManager, chartName string, version string, values map[string]interface{}, opts *exportOptions) []map[string]interface{} {
+	namespace := opts.gitopsNamespace
+	if namespace == "" {
+		namespace = "argocd"
+	}
+
+	helm := map[string]interface{}{"releaseName": opts.releaseName}
+	if len(values) > 0 {
+		helm["valuesObject"] = values
+	}
+
+	return []map[string]interface{}{{
+		"apiVersion": "argoproj.io/v1alpha1",
+		"kind":       "Application",
+		"metadata": map[string]interface{}{
+			"name":      opts.releaseName,
+			"namespace": namespace,
+		},
+		"spec": map[string]interface{}{
+			"project": "default",
+			"source": map[string]interface{}{
+				// argo cd expects OCI helm repositories without the scheme
+				"repoURL":        strings.TrimPrefix(manager.Registry(), "oci://"),
+				"chart":          chartName,
+				"targetRevision": version,
+				"helm":           helm,
+			},
+			"destination": map[string]interface{}{
+				"server":    "https://kubernetes.default.svc",
+				"namespace": manager.Namespace(),
+			},
+			"syncPolicy": map[string]interface{}{
+				"syncOptions": []interface{}{"CreateNamespace=true"},
+			},
+		},
+	}}
+}
+
+func fluxHelmRelease(manager *chartManager.ChartManager, chartName string, version string, values map[string]interface{}, opts *exportOptions) []map[string]interface{} {
+	namespace := opts.gitopsNamespace
+	if namespace == "" {
+		namespace = "flux-system"
+	}
+
+	repository := map[string]interface{}{
+		"apiVersion": "source.toolkit.fluxcd.io/v1beta2",
+		"kind":       "OCIRepository",
+		"metadata": map[string]interface{}{
+			"name":      opts.releaseName,
+			"namespace": namespace,
+		},
+		"spec": map[string]interface{}{
+			"interval": opts.interval,
+			"url":      fmt.Sprintf("%s/%s", manager.Registry(), chartName),
+			"ref":      map[string]interface{}{"tag": version},
+			"layerSelector": map[string]interface{}{
+				"mediaType": helmChartLayerMediaType,
+				"operation": "copy",
+			},
+		},
+	}
+
+	spec := map[string]interface{}{
+		"interval":         opts.interval,
+		"releaseName":      opts.releaseName,
+		"targetNamespace":  manager.Namespace(),
+		"storageNamespace": manager.Namespace(),
+		"install": map[string]interface{}{
+			"createNamespace": true,
+		},
+		"chartRef": map[string]interface{}{
+			"kind": "OCIRepository",
+			"name": opts.releaseName,
+		},
+	}
+	if len(values) > 0 {
+		spec["values"] = values
+	}
+
+	release := map[string]interface{}{
+		"apiVersion": "helm.toolkit.fluxcd.io/v2",
+		"kind":       "HelmRelease",
+		"metadata": map[string]interface{}{
+			"name":      opts.releaseName,
+			"namespace": namespace,
+		},
+		"spec": spec,
+	}
+
+	return []map[string]interface{}{repository, release}
+}
@@ -0,0 +1,240 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	chartManager "github.com/cosmonic/kubectl-cosmo/pkg/internal/chartmanager"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+type GetConfig struct {
+	manager  *chartManager.ChartManager
+	output   string
+	watch    bool
+	selector string
+	genericiooptions.IOStreams
+
+	labelSelector labels.Selector
+	client        kubernetes.Interface
+	dynamic       dynamic.Interface
+	logger        *log.Logger
+}
+
+func NewCmdGet(streams genericiooptions.IOStreams) *cobra.Command {
+	get := &GetConfig{IOStreams: streams, logger: log.Default()}
+
+	cmd := &cobra.Command{
+		Use:   "get [resource] [flags]",
+		Short: "Display the wasmCloud resources running on the platform",
+	}
+
+	cmd.PersistentFlags().StringVarP(&get.output, "output", "o", "", "output format, one of wide, json or yaml")
+	cmd.PersistentFlags().BoolVarP(&get.watch, "watch", "w", false, "after listing, watch for changes")
+	cmd.PersistentFlags().StringVarP(&get.selector, "selector", "l", "", "label selector to filter on, such as key1=value1,key2=value2")
+
+	cmd.AddCommand(get.newCmdGetHosts())
+	cmd.AddCommand(get.newCmdGetWorkloads("Component", "components", []string{"component", "comp"}))
+	cmd.AddCommand(get.newCmdGetWorkloads("Provider", "providers", []string{"provider"}))
+
+	return cmd
+}
+
+// Initialize builds the kubernetes clients and the chart manager used to find the hostgroup releases
+func (get *GetConfig) Initialize(cmd *cobra.Command, args []string) error {
+	client, config, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+	get.client = client
+
+	get.dynamic, err = dynamic.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+
+	helmDriver := os.Getenv("HELM_DRIVER")
+	get.manager, err = chartManager.New(get.IOStreams, helmDriver, get.logger)
+	return err
+}
+
+// Validate checks the output format and parses the label selector
+func (get *GetConfig) Validate() error {
+	if err := validateOutputFormat(get.output, outputWide); err != nil {
+		return err
+	}
+
+	selector, err := labels.Parse(get.selector)
+	if err != nil {
+		return fmt.Errorf("invalid --selector: %w", err)
+	}
+	get.labelSelector = selector
+	return nil
+}
+
+// table is a set of rows printed by the get commands, keyed so watch can print only what changed
+type table struct {
+	headers     []string
+	wideHeaders []string
+	keys        []string
+	rows        map[string][]string
+	objects     map[string]interface{}
+}
+
+func newTable(headers []string, wideHeaders []string) *table {
+	return &table{headers: headers, wideHeaders: wideHeaders, rows: map[string][]string{}, objects: map[string]interface{}{}}
+}
+
+// add appends a row, wide holds the extra columns of -o wide
+func (t *table) add(key string, object interface{}, row []string, wide []string) {
+	t.keys = append(t.keys, key)
+	t.rows[key] = append(row, wide...)
+	t.objects[key] = object
+}
+
+// row returns the columns of key in the output format
+func (t *table) row(key string, output string) []string {
+	row := t.rows[key]
+	if output != outputWide {
+		row = row[:len(t.headers)]
+	}
+	return row
+}
+
+// print writes the rows of keys. Structured output is a single list, unless watching where every
+// object is written on its own so each change can be consumed as it arrives.
+func (t *table) print(out io.Writer, output string, keys []string, watching bool, header bool) error {
+	switch output {
+	case outputJSON, outputYAML:
+		if !watching {
+			objects := []interface{}{}
+			for _, key := range keys {
+				objects = append(objects, t.objects[key])
+			}
+			return printStructured(out, output, objects)
+		}
+		for _, key := range keys {
+			if output == outputYAML {
+				fmt.Fprintln(out, "---")
+			}
+			if err := printStructured(out, output, t.objects[key]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	if header {
+		headers := t.headers
+		if output == outputWide {
+			headers = append(append([]string{}, headers...), t.wideHeaders...)
+		}
+		fmt.Fprintln(w, strings.Join(headers, "\t"))
+	}
+	for _, key := range keys {
+		fmt.Fprintln(w, strings.Join(t.row(key, output), "\t"))
+	}
+	return w.Flush()
+}
+
+// watchSource opens a watch on one of the resources a table is built from
+type watchSource func(ctx context.Context) (watch.Interface, error)
+
+// list prints the table, and with --watch keeps rebuilding it whenever a source reports a change,
+// printing the rows that were added or changed until interrupted
+func (get *GetConfig) list(ctx context.Context, build func(ctx context.Context) (*table, error), sources ...watchSource) error {
+	current, err := build(ctx)
+	if err != nil {
+		return err
+	}
+	if len(current.keys) == 0 && !get.watch && get.output == "" {
+		fmt.Fprintln(get.ErrOut, "No resources found")
+		return nil
+	}
+	if err := current.print(get.Out, get.output, current.keys, get.watch, true); err != nil {
+		return err
+	}
+	if !get.watch {
+		return nil
+	}
+
+	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt)
+	defer cancel()
+
+	changed := make(chan struct{}, 1)
+	for _, source := range sources {
+		go get.watchSource(ctx, source, changed)
+	}
+
+	printed := len(current.keys) > 0
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changed:
+		}
+
+		next, err := build(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			fmt.Fprintf(get.ErrOut, "error listing: %v\n", err)
+			continue
+		}
+
+		var keys []string
+		for _, key := range next.keys {
+			// compare the objects rather than the rows, which hold ages that change on every rebuild
+			if old, ok := current.objects[key]; !ok || !reflect.DeepEqual(old, next.objects[key]) {
+				keys = append(keys, key)
+			}
+		}
+		if len(keys) > 0 {
+			if err := next.print(get.Out, get.output, keys, true, !printed); err != nil {
+				return err
+			}
+			printed = true
+		}
+		current = next
+	}
+}
+
+// watchSource signals changed on every event of the source, reopening the watch when it ends
+func (get *GetConfig) watchSource(ctx context.Context, source watchSource, changed chan<- struct{}) {
+	for ctx.Err() == nil {
+		watcher, err := source(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				fmt.Fprintf(get.ErrOut, "error watching: %v\n", err)
+				select {
+				case <-ctx.Done():
+				case <-time.After(5 * time.Second):
+				}
+			}
+			continue
+		}
+
+		for range watcher.ResultChan() {
+			select {
+			case changed <- struct{}{}:
+			default:
+			}
+		}
+		watcher.Stop()
+	}
+}
@@ -0,0 +1,303 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// releaseInstanceLabel is the label helm charts put on the objects of a release
+const releaseInstanceLabel = "app.kubernetes.io/instance"
+
+// hostInfo is a wasmCloud host, joined from its pod and its Host custom resource when one exists
+type hostInfo struct {
+	Name       string            `json:"name"`
+	Hostgroup  string            `json:"hostgroup"`
+	Node       string            `json:"node"`
+	Pod        string            `json:"pod,omitempty"`
+	IP         string            `json:"ip,omitempty"`
+	Version    string            `json:"version,omitempty"`
+	Ready      bool              `json:"ready"`
+	StartedAt  *time.Time        `json:"startedAt,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Components int               `json:"components"`
+	Providers  int               `json:"providers"`
+}
+
+func (get *GetConfig) newCmdGetHosts() *cobra.Command {
+	return &cobra.Command{
+		Use:     "hosts [flags]",
+		Aliases: []string{"host"},
+		Short:   "List the wasmCloud hosts running in the hostgroups",
+		Example: `  # hosts with their pod, IP and version
+  kubectl cosmo get hosts -o wide
+
+  # follow hosts joining and leaving a hostgroup
+  kubectl cosmo get hosts -l app.kubernetes.io/instance=hostgroup --watch`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := get.Initialize(cmd, args); err != nil {
+				return err
+			}
+			if err := get.Validate(); err != nil {
+				return err
+			}
+
+			return get.RunHosts(cmd.Context())
+		},
+	}
+}
+
+// RunHosts lists the hosts of every hostgroup release in the install namespace
+func (get *GetConfig) RunHosts(ctx context.Context) error {
+	hostResource, hasHosts, err := cosmonicResource(get.client, "Host")
+	if err != nil {
+		return err
+	}
+
+	podSelector := func() (labels.Selector, error) {
+		releases, err := get.manager.ListReleases(hostgroupRepoChartName)
+		if err != nil {
+			return nil, err
+		}
+		if len(releases) == 0 {
+			return nil, nil
+		}
+		requirement, err := labels.NewRequirement(releaseInstanceLabel, selection.In, releases)
+		if err != nil {
+			return nil, err
+		}
+		return labels.NewSelector().Add(*requirement), nil
+	}
+
+	build := func(ctx context.Context) (*table, error) {
+		selector, err := podSelector()
+		if err != nil {
+			return nil, err
+		}
+
+		var pods []corev1.Pod
+		if selector != nil {
+			podList, err := get.client.CoreV1().Pods(cosmonicNamespace).List(ctx, v1.ListOptions{LabelSelector: selector.String()})
+			if err != nil {
+				return nil, err
+			}
+			pods = podList.Items
+		}
+
+		var hostObjects []unstructured.Unstructured
+		if hasHosts {
+			list, err := get.dynamic.Resource(hostResource).Namespace(cosmonicNamespace).List(ctx, v1.ListOptions{})
+			if err != nil {
+				return nil, err
+			}
+			hostObjects = list.Items
+		}
+
+		return get.hostsTable(joinHosts(pods, hostObjects)), nil
+	}
+
+	// watch the pods of every release so hostgroups installed while watching are picked up
+	sources := []watchSource{func(ctx context.Context) (watch.Interface, error) {
+		return get.client.CoreV1().Pods(cosmonicNamespace).Watch(ctx, v1.ListOptions{LabelSelector: releaseInstanceLabel})
+	}}
+	if hasHosts {
+		sources = append(sources, func(ctx context.Context) (watch.Interface, error) {
+			return get.dynamic.Resource(hostResource).Namespace(cosmonicNamespace).Watch(ctx, v1.ListOptions{})
+		})
+	}
+
+	return get.list(ctx, build, sources...)
+}
+
+// hostsTable filters the hosts on the label selector, matched against the host and pod labels
+func (get *GetConfig) hostsTable(hosts []hostInfo) *table {
+	t := newTable([]string{"NAME", "HOSTGROUP", "NODE", "UPTIME", "COMPONENTS", "PROVIDERS", "LABELS"}, []string{"POD", "IP", "VERSION", "READY"})
+
+	for _, host := range hosts {
+		if !get.labelSelector.Matches(labels.Set(host.Labels)) {
+			continue
+		}
+
+		uptime := "-"
+		if host.StartedAt != nil {
+			uptime = duration.HumanDuration(time.Since(*host.StartedAt))
+		}
+
+		t.add(host.Name, host,
+			[]string{host.Name, orDash(host.Hostgroup), orDash(host.Node), uptime,
+				strconv.Itoa(host.Components), strconv.Itoa(host.Providers), formatLabels(host.Labels)},
+			[]string{orDash(host.Pod), orDash(host.IP), orDash(host.Version), strconv.FormatBool(host.Ready)})
+	}
+	return t
+}
+
+// joinHosts matches Host resources to their pods. A pod without a Host resource is a host that has
+// not registered yet, a Host without a pod is shown with what the resource reports.
+func joinHosts(pods []corev1.Pod, hostObjects []unstructured.Unstructured) []hostInfo {
+	byPod := map[string]*unstructured.Unstructured{}
+	for i := range hostObjects {
+		byPod[hostPodName(&hostObjects[i])] = &hostObjects[i]
+	}
+
+	var hosts []hostInfo
+	matched := map[string]bool{}
+	for i := range pods {
+		pod := &pods[i]
+		host := hostInfo{
+			Name:      pod.Name,
+			Hostgroup: pod.Labels[releaseInstanceLabel],
+			Node:      pod.Spec.NodeName,
+			Pod:       pod.Name,
+			IP:        pod.Status.PodIP,
+			Ready:     isPodReady(pod),
+			Labels:    map[string]string{},
+		}
+		if pod.Status.StartTime != nil {
+			host.StartedAt = &pod.Status.StartTime.Time
+		}
+		if len(pod.Spec.Containers) > 0 {
+			host.Version = imageTag(pod.Spec.Containers[0].Image)
+		}
+		for k, v := range pod.Labels {
+			host.Labels[k] = v
+		}
+
+		if object, ok := byPod[pod.Name]; ok {
+			matched[pod.Name] = true
+			mergeHostResource(&host, object)
+		}
+		hosts = append(hosts, host)
+	}
+
+	for podName, object := range byPod {
+		if matched[podName] {
+			continue
+		}
+		host := hostInfo{Name: object.GetName(), Hostgroup: object.GetLabels()[releaseInstanceLabel], Labels: map[string]string{}}
+		if created := object.GetCreationTimestamp().Time; !created.IsZero() {
+			host.StartedAt = &created
+		}
+		mergeHostResource(&host, object)
+		hosts = append(hosts, host)
+	}
+
+	sort.Slice(hosts, func(i, j int) bool {
+		if hosts[i].Hostgroup != hosts[j].Hostgroup {
+			return hosts[i].Hostgroup < hosts[j].Hostgroup
+		}
+		return hosts[i].Name < hosts[j].Name
+	})
+	return hosts
+}
+
+// hostPodName is the pod a Host resource runs in, taken from its status or otherwise its name
+func hostPodName(object *unstructured.Unstructured) string {
+	if name := firstNestedString(object, []string{"status", "podName"}, []string{"status", "hostname"}, []string{"spec", "hostname"}); name != "" {
+		return name
+	}
+	return object.GetName()
+}
+
+// mergeHostResource fills the host with the identity, labels and workload counts reported by its Host resource
+func mergeHostResource(host *hostInfo, object *unstructured.Unstructured) {
+	host.Name = object.GetName()
+	if hostgroup := firstNestedString(object, []string{"spec", "hostGroup"}, []string{"status", "hostGroup"}); hostgroup != "" {
+		host.Hostgroup = hostgroup
+	}
+	if node := firstNestedString(object, []string{"status", "nodeName"}); node != "" && host.Node == "" {
+		host.Node = node
+	}
+	if version := firstNestedString(object, []string{"status", "version"}); version != "" {
+		host.Version = version
+	}
+	if started := firstNestedString(object, []string{"status", "startedAt"}); started != "" {
+		if t, err := time.Parse(time.RFC3339, started); err == nil {
+			host.StartedAt = &t
+		}
+	}
+
+	for _, path := range [][]string{{"spec", "labels"}, {"status", "labels"}} {
+		hostLabels, _, _ := unstructured.NestedStringMap(object.Object, path...)
+		for k, v := range hostLabels {
+			host.Labels[k] = v
+		}
+	}
+
+	host.Components = nestedCount(object, "status", "components")
+	host.Providers = nestedCount(object, "status", "providers")
+}
+
+// firstNestedString returns the first non-empty string field found at the paths
+func firstNestedString(object *unstructured.Unstructured, paths ...[]string) string {
+	for _, path := range paths {
+		if value, found, _ := unstructured.NestedString(object.Object, path...); found && value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// nestedCount reads a field that is either a count or a list or map of the counted items
+func nestedCount(object *unstructured.Unstructured, path ...string) int {
+	value, found, _ := unstructured.NestedFieldNoCopy(object.Object, path...)
+	if !found {
+		return 0
+	}
+	switch v := value.(type) {
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	case []interface{}:
+		return len(v)
+	case map[string]interface{}:
+		return len(v)
+	}
+	return 0
+}
+
+// formatLabels prints labels as sorted key=value pairs, leaving out the ones helm and kubernetes set
+func formatLabels(hostLabels map[string]string) string {
+	var pairs []string
+	for k, v := range hostLabels {
+		if strings.HasPrefix(k, "app.kubernetes.io/") || strings.HasPrefix(k, "helm.sh/") || k == "pod-template-hash" ||
+			k == "controller-revision-hash" || k == "statefulset.kubernetes.io/pod-name" || k == "pod-template-generation" {
+			continue
+		}
+		pairs = append(pairs, fmt.Sprintf("%s=%s", k, v))
+	}
+	if len(pairs) == 0 {
+		return "<none>"
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// imageTag returns the tag of an image reference, empty when it has none
+func imageTag(image string) string {
+	image, _, _ = strings.Cut(image, "@")
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[i+1:]
+	}
+	return ""
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestImageTag(t *testing.T) {
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{image: "ghcr.io/wasmcloud/wasmcloud:1.6.0", want: "1.6.0"},
+		{image: "localhost:5000/wasmcloud:1.6.0", want: "1.6.0"},
+		{image: "localhost:5000/wasmcloud", want: ""},
+		{image: "wasmcloud", want: ""},
+		{image: "ghcr.io/wasmcloud/wasmcloud:1.6.0@sha256:abcd", want: "1.6.0"},
+		{image: "ghcr.io/wasmcloud/wasmcloud@sha256:abcd", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			if got := imageTag(tt.image); got != tt.want {
+				t.Errorf("imageTag(%q) = %q, want %q", tt.image, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNestedCount(t *testing.T) {
+	tests := []struct {
+		name   string
+		status map[string]interface{}
+		want   int
+	}{
+		{name: "missing", status: map[string]interface{}{}, want: 0},
+		{name: "integer", status: map[string]interface{}{"components": int64(4)}, want: 4},
+		{name: "float", status: map[string]interface{}{"components": float64(2)}, want: 2},
+		{name: "list", status: map[string]interface{}{"components": []interface{}{"a", "b", "c"}}, want: 3},
+		{name: "map", status: map[string]interface{}{"components": map[string]interface{}{"a": 1}}, want: 1},
+		{name: "string", status: map[string]interface{}{"components": "4"}, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			object := &unstructured.Unstructured{Object: map[string]interface{}{"status": tt.status}}
+			if got := nestedCount(object, "status", "components"); got != tt.want {
+				t.Errorf("nestedCount() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJoinHosts(t *testing.T) {
+	pod := func(name, hostgroup string) corev1.Pod {
+		return corev1.Pod{
+			ObjectMeta: v1.ObjectMeta{Name: name, Labels: map[string]string{releaseInstanceLabel: hostgroup}},
+			Spec:       corev1.PodSpec{NodeName: "node-1", Containers: []corev1.Container{{Image: "wasmcloud:1.6.0"}}},
+		}
+	}
+	host := func(name string, status map[string]interface{}) unstructured.Unstructured {
+		return unstructured.Unstructured{Object: map[string]interface{}{
+			"metadata": map[string]interface{}{"name": name},
+			"status":   status,
+		}}
+	}
+
+	tests := []struct {
+		name  string
+		pods  []corev1.Pod
+		hosts []unstructured.Unstructured
+		want  []hostInfo
+	}{
+		{
+			name: "pod without a Host resource",
+			pods: []corev1.Pod{pod("hostgroup-0", "hostgroup")},
+			want: []hostInfo{{
+				Name: "hostgroup-0", Hostgroup: "hostgroup", Node: "node-1", Pod: "hostgroup-0", Version: "1.6.0",
+				Labels: map[string]string{releaseInstanceLabel: "hostgroup"},
+			}},
+		},
+		{
+			name:  "Host resource matched by pod name",
+			pods:  []corev1.Pod{pod("hostgroup-0", "hostgroup")},
+			hosts: []unstructured.Unstructured{host("NABC", map[string]interface{}{"podName": "hostgroup-0", "version": "1.7.0", "components": int64(2)})},
+			want: []hostInfo{{
+				Name: "NABC", Hostgroup: "hostgroup", Node: "node-1", Pod: "hostgroup-0", Version: "1.7.0", Components: 2,
+				Labels: map[string]string{releaseInstanceLabel: "hostgroup"},
+			}},
+		},
+		{
+			name:  "Host resource without a pod",
+			hosts: []unstructured.Unstructured{host("NDEF", map[string]interface{}{"hostGroup": "edge", "nodeName": "node-2"})},
+			want:  []hostInfo{{Name: "NDEF", Hostgroup: "edge", Node: "node-2", Labels: map[string]string{}}},
+		},
+		{
+			name: "sorted by hostgroup then name",
+			pods: []corev1.Pod{pod("b-1", "b"), pod("a-1", "a"), pod("a-0", "a")},
+			want: []hostInfo{
+				{Name: "a-0", Hostgroup: "a", Node: "node-1", Pod: "a-0", Version: "1.6.0", Labels: map[string]string{releaseInstanceLabel: "a"}},
+				{Name: "a-1", Hostgroup: "a", Node: "node-1", Pod: "a-1", Version: "1.6.0", Labels: map[string]string{releaseInstanceLabel: "a"}},
+				{Name: "b-1", Hostgroup: "b", Node: "node-1", Pod: "b-1", Version: "1.6.0", Labels: map[string]string{releaseInstanceLabel: "b"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := joinHosts(tt.pods, tt.hosts); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("joinHosts() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// workloadInfo is a component or provider custom resource and where it is placed
+type workloadInfo struct {
+	Namespace     string    `json:"namespace"`
+	Name          string    `json:"name"`
+	Image         string    `json:"image"`
+	Replicas      int       `json:"replicas"`
+	ReadyReplicas int       `json:"readyReplicas"`
+	Hosts         []string  `json:"hosts,omitempty"`
+	Status        string    `json:"status"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// workloadFlags select the namespaces the workloads are listed from
+type workloadFlags struct {
+	namespace     string
+	allNamespaces bool
+}
+
+// newCmdGetWorkloads builds the get subcommand for a wasmCloud workload kind such as Component or Provider
+func (get *GetConfig) newCmdGetWorkloads(kind string, use string, aliases []string) *cobra.Command {
+	flags := &workloadFlags{}
+
+	cmd := &cobra.Command{
+		Use:     use + " [flags]",
+		Aliases: aliases,
+		Short:   fmt.Sprintf("List the wasmCloud %s deployed on the platform", use),
+		Example: fmt.Sprintf(`  # %[1]s in every namespace
+  kubectl cosmo get %[1]s -A
+
+  # %[1]s of one application, following placement changes
+  kubectl cosmo get %[1]s -n apps -l app=hello --watch`, use),
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := get.Initialize(cmd, args); err != nil {
+				return err
+			}
+			if err := get.Validate(); err != nil {
+				return err
+			}
+
+			return get.RunWorkloads(cmd.Context(), kind, flags)
+		},
+	}
+
+	cmd.Flags().StringVarP(&flags.namespace, "namespace", "n", "", "namespace to list from (default the namespace of the current context)")
+	cmd.Flags().BoolVarP(&flags.allNamespaces, "all-namespaces", "A", false, "list across all namespaces")
+
+	return cmd
+}
+
+// RunWorkloads lists the custom resources of the kind, filtered server side on the label selector
+func (get *GetConfig) RunWorkloads(ctx context.Context, kind string, flags *workloadFlags) error {
+	resource, found, err := cosmonicResource(get.client, kind)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("the %s resource is not served by the cluster, is Cosmonic Control installed?", kind)
+	}
+
+	namespace := flags.namespace
+	if flags.allNamespaces {
+		namespace = v1.NamespaceAll
+	} else if namespace == "" {
+		namespace, err = currentNamespace()
+		if err != nil {
+			return err
+		}
+	}
+
+	resources := get.dynamic.Resource(resource).Namespace(namespace)
+	opts := v1.ListOptions{LabelSelector: get.labelSelector.String()}
+
+	build := func(ctx context.Context) (*table, error) {
+		list, err := resources.List(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		var workloads []workloadInfo
+		for i := range list.Items {
+			workloads = append(workloads, newWorkloadInfo(&list.Items[i]))
+		}
+		return workloadsTable(workloads, flags.allNamespaces), nil
+	}
+
+	return get.list(ctx, build, func(ctx context.Context) (watch.Interface, error) {
+		return resources.Watch(ctx, opts)
+	})
+}
+
+func workloadsTable(workloads []workloadInfo, allNamespaces bool) *table {
+	headers := []string{"NAME", "IMAGE", "REPLICAS", "HOSTS", "STATUS", "AGE"}
+	if allNamespaces {
+		headers = append([]string{"NAMESPACE"}, headers...)
+	}
+	t := newTable(headers, nil)
+
+	sort.Slice(workloads, func(i, j int) bool {
+		if workloads[i].Namespace != workloads[j].Namespace {
+			return workloads[i].Namespace < workloads[j].Namespace
+		}
+		return workloads[i].Name < workloads[j].Name
+	})
+
+	for _, workload := range workloads {
+		hosts := "<none>"
+		if len(workload.Hosts) > 0 {
+			hosts = strings.Join(workload.Hosts, ",")
+		}
+
+		row := []string{workload.Name, orDash(workload.Image),
+			fmt.Sprintf("%d/%d", workload.ReadyReplicas, workload.Replicas), hosts, orDash(workload.Status),
+			duration.HumanDuration(time.Since(workload.CreatedAt))}
+		if allNamespaces {
+			row = append([]string{workload.Namespace}, row...)
+		}
+		t.add(workload.Namespace+"/"+workload.Name, workload, row, nil)
+	}
+	return t
+}
+
+// newWorkloadInfo reads the image, replica counts, placement and status from the custom resource
+func newWorkloadInfo(object *unstructured.Unstructured) workloadInfo {
+	workload := workloadInfo{
+		Namespace: object.GetNamespace(),
+		Name:      object.GetName(),
+		Image:     firstNestedString(object, []string{"spec", "image"}, []string{"spec", "imageRef"}),
+		Replicas:  1,
+		CreatedAt: object.GetCreationTimestamp().Time,
+	}
+
+	for _, path := range [][]string{{"spec", "replicas"}, {"spec", "instances"}} {
+		if _, found, _ := unstructured.NestedFieldNoCopy(object.Object, path...); found {
+			workload.Replicas = nestedCount(object, path...)
+			break
+		}
+	}
+	workload.ReadyReplicas = nestedCount(object, "status", "readyReplicas")
+
+	// hosts are reported as a list of names or of placement objects
+	if hosts, found, _ := unstructured.NestedSlice(object.Object, "status", "hosts"); found {
+		for _, host := range hosts {
+			switch h := host.(type) {
+			case string:
+				workload.Hosts = append(workload.Hosts, h)
+			case map[string]interface{}:
+				for _, key := range []string{"name", "hostName", "hostId"} {
+					if name, ok := h[key].(string); ok && name != "" {
+						workload.Hosts = append(workload.Hosts, name)
+						break
+					}
+				}
+			}
+		}
+	}
+
+	workload.Status = workloadStatus(object)
+	return workload
+}
+
+// workloadStatus is the phase of the resource, or otherwise derived from its Ready condition
+func workloadStatus(object *unstructured.Unstructured) string {
+	if phase := firstNestedString(object, []string{"status", "phase"}); phase != "" {
+		return phase
+	}
+
+	conditions, _, _ := unstructured.NestedSlice(object.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok || condition["type"] != "Ready" {
+			continue
+		}
+		if condition["status"] == "True" {
+			return "Ready"
+		}
+		if reason, ok := condition["reason"].(string); ok && reason != "" {
+			return reason
+		}
+		return "NotReady"
+	}
+	return ""
+}
@@ -2,10 +2,14 @@ package cmd
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"os"
+	"time"
 
 	chartManager "github.com/cosmonic/kubectl-cosmo/pkg/internal/chartmanager"
+	"github.com/cosmonic/kubectl-cosmo/pkg/internal/jointoken"
 	"github.com/spf13/cobra"
 	"helm.sh/helm/v3/pkg/cli"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
@@ -21,6 +25,11 @@ type HostgroupConfig struct {
 	manager        *chartManager.ChartManager
 	configFlags    *genericclioptions.ConfigFlags
 	forceUninstall *bool
+	releaseFlags   releaseFlags
+	join           string
+	updateFlags    hostgroupUpdateFlags
+	noDrain        bool
+	drainTimeout   time.Duration
 	genericiooptions.IOStreams
 
 	settings *cli.EnvSettings
@@ -53,27 +62,88 @@ func NewCmdHostgroup(streams genericiooptions.IOStreams) *cobra.Command {
 	var installCmd = &cobra.Command{
 		Use:   "install",
 		Short: "installs a new hostgroup instance",
+		Example: `  # hostgroup joining the nexus of the same cluster
+  kubectl cosmo hostgroup install
+
+  # hostgroup joining the nexus of another cluster, the token created there with
+  # kubectl cosmo nexus join-token create
+  kubectl cosmo hostgroup install --join join.token`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if err := hostGroup.Initialize(cmd, args); err != nil {
 				return err
 			}
 
-			return hostGroup.manager.Install(context.TODO(), hostgroupRepoChartName)
+			opts, err := hostGroup.releaseFlags.options()
+			if err != nil {
+				return err
+			}
+
+			if len(hostGroup.join) == 0 {
+				return hostGroup.manager.InstallRelease(context.TODO(), hostgroupInstalledChartName, hostgroupRepoChartName, opts)
+			}
+
+			// the join secret of an installed hostgroup must not be replaced
+			if _, err := hostGroup.manager.GetRelease(hostgroupInstalledChartName); err == nil {
+				return errors.New("chart is already installed")
+			} else if !errors.Is(err, chartManager.ErrReleaseNotFound) {
+				return err
+			}
+
+			values, err := hostGroup.joinRemoteNexus(context.TODO())
+			if err != nil {
+				return err
+			}
+			opts.Values = values
+			// refuse charts that would ignore the join values and run without a nexus
+			opts.RequiredValues = valuePaths(values)
+
+			if err := hostGroup.manager.InstallRelease(context.TODO(), hostgroupInstalledChartName, hostgroupRepoChartName, opts); err != nil {
+				// no hostgroup uses the join credential, do not leave it behind
+				if rmErr := hostGroup.removeJoinSecret(context.TODO(), hostgroupInstalledChartName); rmErr != nil {
+					fmt.Fprintf(hostGroup.ErrOut, "warning: failed to remove the secret %s: %v\n", joinSecretName(hostgroupInstalledChartName), rmErr)
+				}
+				return err
+			}
+			return nil
 		},
 	}
+	hostGroup.releaseFlags.addFlags(installCmd.Flags())
+	installCmd.Flags().StringVar(&hostGroup.join, "join", "", "join token, or a file holding one, of a nexus running in another cluster")
 
 	// update command
 	var updateCmd = &cobra.Command{
-		Use:   "update",
+		Use:   "update [name...]",
 		Short: "updates the hostgroup instances",
+		Example: `  # update the default hostgroup
+  kubectl cosmo hostgroup update
+
+  # update every hostgroup one at a time, waiting for hosts and workloads in between
+  kubectl cosmo hostgroup update --all --strategy rolling --pause-between 1m
+
+  # update two hostgroups at a time
+  kubectl cosmo hostgroup update --all --max-parallel 2`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if err := hostGroup.Initialize(cmd, args); err != nil {
 				return err
 			}
+			if err := hostGroup.updateFlags.validate(args); err != nil {
+				return err
+			}
 
-			return hostGroup.manager.Update(hostgroupInstalledChartName)
+			opts, err := hostGroup.releaseFlags.options()
+			if err != nil {
+				return err
+			}
+
+			return hostGroup.UpdateReleases(cmd.Context(), args, opts)
 		},
 	}
+	hostGroup.releaseFlags.addFlags(updateCmd.Flags())
+	updateCmd.Flags().BoolVar(&hostGroup.updateFlags.all, "all", false, "update every installed hostgroup")
+	updateCmd.Flags().StringVar(&hostGroup.updateFlags.strategy, "strategy", strategyRolling, fmt.Sprintf("how several hostgroups are updated, %s or %s", strategyRolling, strategyAllAtOnce))
+	updateCmd.Flags().IntVar(&hostGroup.updateFlags.maxParallel, "max-parallel", 1, "hostgroups updated at the same time by the rolling strategy")
+	updateCmd.Flags().DurationVar(&hostGroup.updateFlags.pauseBetween, "pause-between", 0, "pause between two batches of the rolling strategy")
+	updateCmd.Flags().DurationVar(&hostGroup.updateFlags.timeout, "timeout", 10*time.Minute, "how long to wait for the hosts and workloads of each batch to be ready")
 
 	// uninstall command
 	var uninstallCmd = &cobra.Command{
@@ -84,16 +154,41 @@ func NewCmdHostgroup(streams genericiooptions.IOStreams) *cobra.Command {
 				return err
 			}
 
-			return hostGroup.manager.UnInstall(hostgroupInstalledChartName)
+			// the drain removes the autoscalers only once it is about to scale the hostgroup down
+			if !hostGroup.noDrain {
+				err := hostGroup.Drain(cmd.Context(), hostgroupInstalledChartName, hostGroup.drainTimeout, true)
+				if errors.Is(err, errDrainUnsupported) {
+					fmt.Fprintf(hostGroup.ErrOut, "warning: %v, uninstalling without draining\n", err)
+				} else if err != nil {
+					return fmt.Errorf("%w, pass --no-drain to uninstall anyway", err)
+				}
+			}
+
+			return hostGroup.Uninstall(cmd.Context(), hostgroupInstalledChartName)
 		},
 	}
 	hostGroup.forceUninstall = uninstallCmd.Flags().Bool("force", false, "must specify force to uninstall the nexus control plane")
+	uninstallCmd.Flags().BoolVar(&hostGroup.noDrain, "no-drain", false, "uninstall without first moving the workloads to other hostgroups")
+	uninstallCmd.Flags().DurationVar(&hostGroup.drainTimeout, "drain-timeout", 5*time.Minute, "how long to wait for the workloads to move before uninstalling")
 	uninstallCmd.MarkFlagRequired("force")
 
+	// export command
+	exportCmd := newCmdExport(streams, "hostgroup", hostgroupInstalledChartName, hostgroupRepoChartName, func(cmd *cobra.Command, args []string) (*chartManager.ChartManager, error) {
+		if err := hostGroup.Initialize(cmd, args); err != nil {
+			return nil, err
+		}
+		return hostGroup.manager, nil
+	})
+
 	// add subcommands
 	cmd.AddCommand(installCmd)
 	cmd.AddCommand(updateCmd)
 	cmd.AddCommand(uninstallCmd)
+	cmd.AddCommand(exportCmd)
+	cmd.AddCommand(hostGroup.newCmdScale())
+	cmd.AddCommand(hostGroup.newCmdSet())
+	cmd.AddCommand(hostGroup.newCmdAutoscale())
+	cmd.AddCommand(hostGroup.newCmdDrain())
 
 	return cmd
 }
@@ -111,6 +206,65 @@ func (hostGroup *HostgroupConfig) Initialize(cmd *cobra.Command, args []string)
 	return err
 }
 
+// joinRemoteNexus checks the nexus of the join token is reachable and stores its bundle in a secret
+// next to the hostgroup, returning the values pointing the chart at it
+func (hostGroup *HostgroupConfig) joinRemoteNexus(ctx context.Context) (map[string]interface{}, error) {
+	bundle, err := readJoinToken(hostGroup.join)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := jointoken.CheckReachable(ctx, bundle, joinCheckTimeout); err != nil {
+		return nil, fmt.Errorf("remote nexus %s is not reachable: %w", bundle.Endpoint, err)
+	}
+	hostGroup.logger.Printf("remote nexus %s is reachable\n", bundle.Endpoint)
+
+	client, _, err := newKubeClient()
+	if err != nil {
+		return nil, err
+	}
+
+	secretName := joinSecretName(hostgroupInstalledChartName)
+	if err := jointoken.Apply(ctx, client, hostGroup.manager.Namespace(), secretName, bundle); err != nil {
+		return nil, fmt.Errorf("failed to store the join bundle: %w", err)
+	}
+
+	return joinValues(bundle, secretName), nil
+}
+
+// joinSecretName is the secret holding the bundle of the remote nexus a hostgroup release installed
+// with --join uses
+func joinSecretName(releaseName string) string {
+	return releaseName + "-join"
+}
+
+// removeJoinSecret deletes the secret joinRemoteNexus stored the join bundle of the release in
+func (hostGroup *HostgroupConfig) removeJoinSecret(ctx context.Context, releaseName string) error {
+	client, _, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+	return jointoken.Remove(ctx, client, hostGroup.manager.Namespace(), joinSecretName(releaseName))
+}
+
+// Uninstall uninstalls the hostgroup release along with the autoscalers and join secret created for it
+func (hostGroup *HostgroupConfig) Uninstall(ctx context.Context, releaseName string) error {
+	// an autoscaler left behind would target the deleted workload
+	if err := hostGroup.uninstallAutoscalers(ctx, releaseName); err != nil {
+		return err
+	}
+
+	if err := hostGroup.manager.UnInstall(releaseName); err != nil {
+		return err
+	}
+
+	// the credentials of the remote nexus must not outlive the hostgroup
+	if err := hostGroup.removeJoinSecret(ctx, releaseName); err != nil {
+		return fmt.Errorf("failed to remove the join secret of hostgroup %s: %w", releaseName, err)
+	}
+	return nil
+}
+
 // Valdiate checks the configuration
 func (hostGroup *HostgroupConfig) Validate() error {
 	return nil
@@ -0,0 +1,545 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"helm.sh/helm/v3/pkg/chart"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// scaledObjectResource is the KEDA ScaledObject custom resource
+var scaledObjectResource = schema.GroupVersionResource{Group: "keda.sh", Version: "v1alpha1", Resource: "scaledobjects"}
+
+// triggerMetadataKey starts a key=value pair of a KEDA trigger, telling pairs apart from commas in values
+var triggerMetadataKey = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.-]*=`)
+
+// autoscaleManagedBy labels the autoscalers created by hostgroup autoscale so --off only removes those
+var autoscaleManagedBy = map[string]string{"app.kubernetes.io/managed-by": "kubectl-cosmo"}
+
+// hostgroupAutoscaleFlags configure the autoscaler of a hostgroup
+type hostgroupAutoscaleFlags struct {
+	min          int32
+	max          int32
+	cpuPercent   int32
+	kedaTriggers []string
+	off          bool
+
+	// cpuTrigger adds a CPU trigger to the KEDA triggers, set when --cpu-percent is given
+	cpuTrigger bool
+}
+
+// validate checks the replica bounds unless the autoscaler is being removed
+func (f *hostgroupAutoscaleFlags) validate(cmd *cobra.Command) error {
+	if f.off {
+		for _, name := range []string{"min", "max", "cpu-percent", "keda-trigger"} {
+			if cmd.Flags().Changed(name) {
+				return fmt.Errorf("--off cannot be combined with --%s", name)
+			}
+		}
+		return nil
+	}
+
+	if !cmd.Flags().Changed("max") {
+		return errors.New("--max is required")
+	}
+	if f.min < 1 {
+		return fmt.Errorf("invalid --min %d, must be at least 1", f.min)
+	}
+	if f.max < f.min {
+		return fmt.Errorf("--max %d is lower than --min %d", f.max, f.min)
+	}
+	if f.cpuPercent < 1 {
+		return fmt.Errorf("invalid --cpu-percent %d", f.cpuPercent)
+	}
+	f.cpuTrigger = cmd.Flags().Changed("cpu-percent")
+	return nil
+}
+
+func (hostGroup *HostgroupConfig) newCmdAutoscale() *cobra.Command {
+	flags := &hostgroupAutoscaleFlags{}
+
+	cmd := &cobra.Command{
+		Use:   "autoscale <name> [--min N] --max N [flags]",
+		Short: "Create, update or remove the autoscaler of a hostgroup",
+		Long: `Scale the hosts of a hostgroup with a HorizontalPodAutoscaler on their CPU use or, with
+--keda-trigger, with a KEDA ScaledObject when KEDA is installed. Running autoscale again updates the
+autoscaler, switching between the two removes the other one. With KEDA, --cpu-percent adds a CPU
+trigger to the given ones.
+
+A KEDA trigger is type:key=value[,key=value...], or a YAML or JSON file holding a trigger when its
+metadata values contain commas.
+
+While an autoscaler exists, hostgroup update and set keep the replica count it chose, and hostgroup
+scale is refused. hostgroup uninstall removes the autoscaler.`,
+		Example: `  # keep the hosts between 2 and 10, targeting 70% CPU
+  kubectl cosmo hostgroup autoscale hostgroup --min 2 --max 10 --cpu-percent 70
+
+  # scale up ahead of business hours through KEDA, and on CPU
+  kubectl cosmo hostgroup autoscale hostgroup --max 20 --cpu-percent 70 \
+    --keda-trigger 'cron:timezone=Europe/Amsterdam,start=0 8 * * 1-5,end=0 18 * * 1-5,desiredReplicas=6'
+
+  # remove the autoscaler
+  kubectl cosmo hostgroup autoscale hostgroup --off`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := hostGroup.Initialize(cmd, args); err != nil {
+				return err
+			}
+			if err := flags.validate(cmd); err != nil {
+				return err
+			}
+
+			return hostGroup.Autoscale(cmd.Context(), args[0], flags)
+		},
+	}
+
+	cmd.Flags().Int32Var(&flags.min, "min", 1, "minimum number of hosts")
+	cmd.Flags().Int32Var(&flags.max, "max", 0, "maximum number of hosts")
+	cmd.Flags().Int32Var(&flags.cpuPercent, "cpu-percent", 80, "average CPU utilization of the hosts to target, as a percentage of their requests")
+	cmd.Flags().StringArrayVar(&flags.kedaTriggers, "keda-trigger", nil, "KEDA trigger to scale on instead of a HorizontalPodAutoscaler, can be repeated")
+	cmd.Flags().BoolVar(&flags.off, "off", false, "remove the autoscaler")
+
+	return cmd
+}
+
+// Autoscale creates or updates the HorizontalPodAutoscaler or KEDA ScaledObject targeting the
+// workload of the hostgroup release, or removes them with --off
+func (hostGroup *HostgroupConfig) Autoscale(ctx context.Context, releaseName string, flags *hostgroupAutoscaleFlags) error {
+	client, _, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+	dyn, err := newDynamicClient()
+	if err != nil {
+		return err
+	}
+	namespace := hostGroup.manager.Namespace()
+	hasKeda := hasResource(client, scaledObjectResource.GroupVersion().String(), scaledObjectResource.Resource)
+
+	if flags.off {
+		removed, err := removeAutoscalers(ctx, client, dyn, namespace, releaseName, hasKeda)
+		if err != nil {
+			return err
+		}
+		if len(removed) == 0 {
+			fmt.Fprintf(hostGroup.Out, "hostgroup %s has no autoscaler\n", releaseName)
+			return nil
+		}
+		fmt.Fprintf(hostGroup.Out, "removed %s of hostgroup %s\n", strings.Join(removed, " and "), releaseName)
+		return nil
+	}
+
+	target, err := scaleTarget(ctx, client, namespace, releaseName)
+	if err != nil {
+		return err
+	}
+
+	if len(flags.kedaTriggers) > 0 {
+		if !hasKeda {
+			return errors.New("--keda-trigger needs KEDA, the ScaledObject CRD is not installed")
+		}
+		// KEDA rejects a ScaledObject for a workload that an HPA already scales
+		if _, err := removeHPA(ctx, client, namespace, releaseName); err != nil {
+			return err
+		}
+		if err := applyScaledObject(ctx, dyn, namespace, releaseName, target, flags); err != nil {
+			return err
+		}
+		fmt.Fprintf(hostGroup.Out, "hostgroup %s scales between %d and %d hosts with KEDA\n", releaseName, flags.min, flags.max)
+		return nil
+	}
+
+	// the HPA that KEDA keeps for a ScaledObject would fight the new one
+	if hasKeda {
+		if _, err := removeScaledObject(ctx, dyn, namespace, releaseName); err != nil {
+			return err
+		}
+	}
+	if err := applyHPA(ctx, client, namespace, releaseName, target, flags); err != nil {
+		return err
+	}
+	fmt.Fprintf(hostGroup.Out, "hostgroup %s scales between %d and %d hosts at %d%% CPU\n", releaseName, flags.min, flags.max, flags.cpuPercent)
+	return nil
+}
+
+// componentLabel names the part of the application a workload of the release runs
+const componentLabel = "app.kubernetes.io/component"
+
+// hostWorkloadComponents are the component label values of the workload running the hosts
+var hostWorkloadComponents = []string{"hostgroup", "host"}
+
+// scaleTarget is the deployment or statefulset the hostgroup release runs its hosts in. When the
+// release has several, the one labeled as the host component or named after the release is used.
+func scaleTarget(ctx context.Context, client kubernetes.Interface, namespace string, releaseName string) (*autoscalingv2.CrossVersionObjectReference, error) {
+	opts := v1.ListOptions{LabelSelector: releaseSelector(releaseName)}
+
+	type candidate struct {
+		ref    autoscalingv2.CrossVersionObjectReference
+		labels map[string]string
+	}
+	var candidates []candidate
+
+	deployments, err := client.AppsV1().Deployments(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, deployment := range deployments.Items {
+		candidates = append(candidates, candidate{autoscalingv2.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: "Deployment", Name: deployment.Name}, deployment.Labels})
+	}
+
+	statefulSets, err := client.AppsV1().StatefulSets(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, statefulSet := range statefulSets.Items {
+		candidates = append(candidates, candidate{autoscalingv2.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: "StatefulSet", Name: statefulSet.Name}, statefulSet.Labels})
+	}
+
+	switch len(candidates) {
+	case 0:
+		return nil, fmt.Errorf("no deployment or statefulset found for hostgroup %s in namespace %s", releaseName, namespace)
+	case 1:
+		return &candidates[0].ref, nil
+	}
+
+	var matches []candidate
+	for _, c := range candidates {
+		if slices.Contains(hostWorkloadComponents, c.labels[componentLabel]) {
+			matches = append(matches, c)
+		}
+	}
+	if len(matches) == 0 {
+		for _, c := range candidates {
+			if c.ref.Name == releaseName || c.ref.Name == releaseName+"-"+hostgroupInstalledChartName {
+				matches = append(matches, c)
+			}
+		}
+	}
+	if len(matches) == 1 {
+		return &matches[0].ref, nil
+	}
+
+	names := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		names = append(names, strings.ToLower(c.ref.Kind)+"/"+c.ref.Name)
+	}
+	return nil, fmt.Errorf("cannot tell which workload of hostgroup %s runs the hosts: %s", releaseName, strings.Join(names, ", "))
+}
+
+// targetReplicas is the replica count the autoscaler last set on the target
+func targetReplicas(ctx context.Context, client kubernetes.Interface, namespace string, target *autoscalingv2.CrossVersionObjectReference) (int32, error) {
+	var scale *autoscalingv1.Scale
+	var err error
+	if target.Kind == "StatefulSet" {
+		scale, err = client.AppsV1().StatefulSets(namespace).GetScale(ctx, target.Name, v1.GetOptions{})
+	} else {
+		scale, err = client.AppsV1().Deployments(namespace).GetScale(ctx, target.Name, v1.GetOptions{})
+	}
+	if err != nil {
+		return 0, err
+	}
+	return scale.Spec.Replicas, nil
+}
+
+// pinAutoscaledReplicas sets the replicas value of the chart to the current replica count while an
+// autoscaler scales the hostgroup, so an upgrade does not reset the hosts to the chart's count
+func (hostGroup *HostgroupConfig) pinAutoscaledReplicas(ctx context.Context, releaseName string, chrt *chart.Chart, values map[string]interface{}) error {
+	kind, err := hostGroup.autoscalerKind(ctx, releaseName)
+	if err != nil || kind == "" {
+		return err
+	}
+	path, err := chartValuePath(chrt, "replicaCount", "replicas")
+	if err != nil {
+		// the chart does not render the replicas from its values
+		return nil
+	}
+
+	client, _, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+	namespace := hostGroup.manager.Namespace()
+	target, err := scaleTarget(ctx, client, namespace, releaseName)
+	if err != nil {
+		return err
+	}
+	replicas, err := targetReplicas(ctx, client, namespace, target)
+	if err != nil {
+		return err
+	}
+
+	setValue(values, path, int(replicas))
+	return nil
+}
+
+func autoscalerLabels(releaseName string) map[string]string {
+	labels := map[string]string{releaseInstanceLabel: releaseName}
+	for k, v := range autoscaleManagedBy {
+		labels[k] = v
+	}
+	return labels
+}
+
+func applyHPA(ctx context.Context, client kubernetes.Interface, namespace string, releaseName string, target *autoscalingv2.CrossVersionObjectReference, flags *hostgroupAutoscaleFlags) error {
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: v1.ObjectMeta{Name: releaseName, Namespace: namespace, Labels: autoscalerLabels(releaseName)},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: *target,
+			MinReplicas:    &flags.min,
+			MaxReplicas:    flags.max,
+			Metrics: []autoscalingv2.MetricSpec{{
+				Type: autoscalingv2.ResourceMetricSourceType,
+				Resource: &autoscalingv2.ResourceMetricSource{
+					Name:   corev1.ResourceCPU,
+					Target: autoscalingv2.MetricTarget{Type: autoscalingv2.UtilizationMetricType, AverageUtilization: &flags.cpuPercent},
+				},
+			}},
+		},
+	}
+
+	hpas := client.AutoscalingV2().HorizontalPodAutoscalers(namespace)
+	existing, err := hpas.Get(ctx, releaseName, v1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = hpas.Create(ctx, hpa, v1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if !managedAutoscaler(existing.Labels) {
+		return fmt.Errorf("HorizontalPodAutoscaler %s was not created by hostgroup autoscale, remove it first", releaseName)
+	}
+
+	hpa.ResourceVersion = existing.ResourceVersion
+	_, err = hpas.Update(ctx, hpa, v1.UpdateOptions{})
+	return err
+}
+
+func applyScaledObject(ctx context.Context, dyn dynamic.Interface, namespace string, releaseName string, target *autoscalingv2.CrossVersionObjectReference, flags *hostgroupAutoscaleFlags) error {
+	var triggers []interface{}
+	for _, spec := range flags.kedaTriggers {
+		trigger, err := parseKedaTrigger(spec)
+		if err != nil {
+			return err
+		}
+		triggers = append(triggers, trigger)
+	}
+	if flags.cpuTrigger {
+		triggers = append(triggers, map[string]interface{}{
+			"type":       "cpu",
+			"metricType": "Utilization",
+			"metadata":   map[string]interface{}{"value": fmt.Sprint(flags.cpuPercent)},
+		})
+	}
+
+	object := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": scaledObjectResource.GroupVersion().String(),
+		"kind":       "ScaledObject",
+		"metadata": map[string]interface{}{
+			"name":      releaseName,
+			"namespace": namespace,
+		},
+		"spec": map[string]interface{}{
+			"scaleTargetRef": map[string]interface{}{
+				"apiVersion": target.APIVersion,
+				"kind":       target.Kind,
+				"name":       target.Name,
+			},
+			"minReplicaCount": int64(flags.min),
+			"maxReplicaCount": int64(flags.max),
+			"triggers":        triggers,
+		},
+	}}
+	object.SetLabels(autoscalerLabels(releaseName))
+
+	scaledObjects := dyn.Resource(scaledObjectResource).Namespace(namespace)
+	existing, err := scaledObjects.Get(ctx, releaseName, v1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = scaledObjects.Create(ctx, object, v1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if !managedAutoscaler(existing.GetLabels()) {
+		return fmt.Errorf("ScaledObject %s was not created by hostgroup autoscale, remove it first", releaseName)
+	}
+
+	object.SetResourceVersion(existing.GetResourceVersion())
+	_, err = scaledObjects.Update(ctx, object, v1.UpdateOptions{})
+	return err
+}
+
+// parseKedaTrigger reads a trigger given as type:key=value[,key=value...], or a file holding one
+func parseKedaTrigger(spec string) (map[string]interface{}, error) {
+	if data, err := os.ReadFile(spec); err == nil {
+		trigger := map[string]interface{}{}
+		if err := yaml.Unmarshal(data, &trigger); err != nil {
+			return nil, fmt.Errorf("invalid KEDA trigger in %s: %w", spec, err)
+		}
+		if _, ok := trigger["type"].(string); !ok {
+			return nil, fmt.Errorf("KEDA trigger in %s has no type", spec)
+		}
+		return trigger, nil
+	}
+
+	triggerType, pairs, _ := strings.Cut(spec, ":")
+	if triggerType == "" || pairs == "" {
+		return nil, fmt.Errorf("invalid KEDA trigger %q, must be type:key=value[,key=value...]", spec)
+	}
+
+	// a fragment that does not start a key=value pair belongs to the value before it
+	var fragments []string
+	for _, fragment := range strings.Split(pairs, ",") {
+		if len(fragments) > 0 && !triggerMetadataKey.MatchString(fragment) {
+			fragments[len(fragments)-1] += "," + fragment
+			continue
+		}
+		fragments = append(fragments, fragment)
+	}
+
+	metadata := map[string]interface{}{}
+	for _, fragment := range fragments {
+		key, value, ok := strings.Cut(fragment, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid KEDA trigger %q, must be type:key=value[,key=value...]", spec)
+		}
+		metadata[key] = value
+	}
+
+	return map[string]interface{}{"type": triggerType, "metadata": metadata}, nil
+}
+
+// uninstallAutoscalers deletes the autoscalers hostgroup autoscale created for the release before it
+// is uninstalled
+func (hostGroup *HostgroupConfig) uninstallAutoscalers(ctx context.Context, releaseName string) error {
+	client, _, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+	dyn, err := newDynamicClient()
+	if err != nil {
+		return err
+	}
+	hasKeda := hasResource(client, scaledObjectResource.GroupVersion().String(), scaledObjectResource.Resource)
+
+	removed, err := removeAutoscalers(ctx, client, dyn, hostGroup.manager.Namespace(), releaseName, hasKeda)
+	if err != nil {
+		return fmt.Errorf("failed to remove the autoscaler of hostgroup %s: %w", releaseName, err)
+	}
+	if len(removed) > 0 {
+		fmt.Fprintf(hostGroup.Out, "removed %s of hostgroup %s\n", strings.Join(removed, " and "), releaseName)
+	}
+	return nil
+}
+
+// removeAutoscalers deletes the HorizontalPodAutoscaler and ScaledObject of the hostgroup, returning
+// the kinds that were removed
+func removeAutoscalers(ctx context.Context, client kubernetes.Interface, dyn dynamic.Interface, namespace string, releaseName string, hasKeda bool) ([]string, error) {
+	var removed []string
+
+	deleted, err := removeHPA(ctx, client, namespace, releaseName)
+	if err != nil {
+		return nil, err
+	}
+	if deleted {
+		removed = append(removed, "HorizontalPodAutoscaler")
+	}
+
+	if hasKeda {
+		deleted, err := removeScaledObject(ctx, dyn, namespace, releaseName)
+		if err != nil {
+			return nil, err
+		}
+		if deleted {
+			removed = append(removed, "ScaledObject")
+		}
+	}
+
+	return removed, nil
+}
+
+// removeHPA deletes the HorizontalPodAutoscaler when hostgroup autoscale created it
+func removeHPA(ctx context.Context, client kubernetes.Interface, namespace string, name string) (bool, error) {
+	hpas := client.AutoscalingV2().HorizontalPodAutoscalers(namespace)
+	hpa, err := hpas.Get(ctx, name, v1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil || !managedAutoscaler(hpa.Labels) {
+		return false, err
+	}
+	return true, hpas.Delete(ctx, name, v1.DeleteOptions{})
+}
+
+// removeScaledObject deletes the KEDA ScaledObject when hostgroup autoscale created it
+func removeScaledObject(ctx context.Context, dyn dynamic.Interface, namespace string, name string) (bool, error) {
+	scaledObjects := dyn.Resource(scaledObjectResource).Namespace(namespace)
+	scaledObject, err := scaledObjects.Get(ctx, name, v1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil || !managedAutoscaler(scaledObject.GetLabels()) {
+		return false, err
+	}
+	return true, scaledObjects.Delete(ctx, name, v1.DeleteOptions{})
+}
+
+// autoscalerKind is the kind of the HorizontalPodAutoscaler or KEDA ScaledObject named after the
+// hostgroup release, empty when it has none
+func (hostGroup *HostgroupConfig) autoscalerKind(ctx context.Context, releaseName string) (string, error) {
+	client, _, err := newKubeClient()
+	if err != nil {
+		return "", err
+	}
+	namespace := hostGroup.manager.Namespace()
+
+	_, err = client.AutoscalingV2().HorizontalPodAutoscalers(namespace).Get(ctx, releaseName, v1.GetOptions{})
+	if err == nil {
+		return "HorizontalPodAutoscaler", nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return "", err
+	}
+
+	if !hasResource(client, scaledObjectResource.GroupVersion().String(), scaledObjectResource.Resource) {
+		return "", nil
+	}
+	dyn, err := newDynamicClient()
+	if err != nil {
+		return "", err
+	}
+	_, err = dyn.Resource(scaledObjectResource).Namespace(namespace).Get(ctx, releaseName, v1.GetOptions{})
+	if err == nil {
+		return "ScaledObject", nil
+	}
+	if apierrors.IsNotFound(err) {
+		return "", nil
+	}
+	return "", err
+}
+
+func managedAutoscaler(labels map[string]string) bool {
+	for k, v := range autoscaleManagedBy {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseKedaTrigger(t *testing.T) {
+	dir := t.TempDir()
+	triggerFile := filepath.Join(dir, "trigger.yaml")
+	if err := os.WriteFile(triggerFile, []byte("type: prometheus\nmetadata:\n  query: sum(rate(x[1m]))\n  threshold: \"10\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	untypedFile := filepath.Join(dir, "untyped.yaml")
+	if err := os.WriteFile(untypedFile, []byte("metadata:\n  value: \"1\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		spec    string
+		want    map[string]interface{}
+		wantErr bool
+	}{
+		{
+			name: "single pair",
+			spec: "cpu:value=70",
+			want: map[string]interface{}{"type": "cpu", "metadata": map[string]interface{}{"value": "70"}},
+		},
+		{
+			name: "commas inside a value",
+			spec: "cron:timezone=UTC,start=0 8 * * 1-5,end=0 18 * * 1,2,3,desiredReplicas=6",
+			want: map[string]interface{}{"type": "cron", "metadata": map[string]interface{}{
+				"timezone":        "UTC",
+				"start":           "0 8 * * 1-5",
+				"end":             "0 18 * * 1,2,3",
+				"desiredReplicas": "6",
+			}},
+		},
+		{
+			name: "value holding an equal sign",
+			spec: "prometheus:query=sum(x{a=\"b\"}),threshold=5",
+			want: map[string]interface{}{"type": "prometheus", "metadata": map[string]interface{}{"query": "sum(x{a=\"b\"})", "threshold": "5"}},
+		},
+		{
+			name: "file",
+			spec: triggerFile,
+			want: map[string]interface{}{"type": "prometheus", "metadata": map[string]interface{}{"query": "sum(rate(x[1m]))", "threshold": "10"}},
+		},
+		{name: "file without type", spec: untypedFile, wantErr: true},
+		{name: "no metadata", spec: "cpu:", wantErr: true},
+		{name: "no type", spec: ":value=70", wantErr: true},
+		{name: "no colon", spec: "cpu", wantErr: true},
+		{name: "pair without key", spec: "cpu:=70", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseKedaTrigger(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseKedaTrigger() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseKedaTrigger() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScaleTarget(t *testing.T) {
+	deployment := func(name string, labels map[string]string) runtime.Object {
+		all := map[string]string{releaseInstanceLabel: "hostgroup"}
+		for k, v := range labels {
+			all[k] = v
+		}
+		return &appsv1.Deployment{ObjectMeta: v1.ObjectMeta{Name: name, Namespace: cosmonicNamespace, Labels: all}}
+	}
+	statefulSet := func(name string) runtime.Object {
+		return &appsv1.StatefulSet{ObjectMeta: v1.ObjectMeta{Name: name, Namespace: cosmonicNamespace, Labels: map[string]string{releaseInstanceLabel: "hostgroup"}}}
+	}
+
+	tests := []struct {
+		name     string
+		objects  []runtime.Object
+		wantKind string
+		wantName string
+		wantErr  bool
+	}{
+		{
+			name:     "single deployment",
+			objects:  []runtime.Object{deployment("hosts", nil)},
+			wantKind: "Deployment",
+			wantName: "hosts",
+		},
+		{
+			name:     "single statefulset",
+			objects:  []runtime.Object{statefulSet("hosts")},
+			wantKind: "StatefulSet",
+			wantName: "hosts",
+		},
+		{
+			name:     "component label",
+			objects:  []runtime.Object{deployment("a-cache", map[string]string{componentLabel: "cache"}), deployment("b-hosts", map[string]string{componentLabel: "host"})},
+			wantKind: "Deployment",
+			wantName: "b-hosts",
+		},
+		{
+			name:     "named after the release",
+			objects:  []runtime.Object{deployment("a-cache", nil), deployment("hostgroup", nil)},
+			wantKind: "Deployment",
+			wantName: "hostgroup",
+		},
+		{
+			name:    "ambiguous",
+			objects: []runtime.Object{deployment("a", nil), statefulSet("b")},
+			wantErr: true,
+		},
+		{
+			name:    "other release only",
+			objects: []runtime.Object{&appsv1.Deployment{ObjectMeta: v1.ObjectMeta{Name: "other", Namespace: cosmonicNamespace, Labels: map[string]string{releaseInstanceLabel: "other"}}}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset(tt.objects...)
+			got, err := scaleTarget(context.Background(), client, cosmonicNamespace, "hostgroup")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("scaleTarget() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.Kind != tt.wantKind || got.Name != tt.wantName {
+				t.Errorf("scaleTarget() = %s %s, want %s %s", got.Kind, got.Name, tt.wantKind, tt.wantName)
+			}
+		})
+	}
+}
@@ -0,0 +1,408 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// drainLabel marks the Host resources of a drained hostgroup, alongside spec.unschedulable which
+	// keeps the platform from placing new workloads on them
+	drainLabel = "cosmonic.io/draining"
+	// drainedReplicasAnnotation keeps the replica count of a drained hostgroup workload for drain --undo
+	drainedReplicasAnnotation = "cosmonic.io/drained-replicas"
+)
+
+// errDrainUnsupported is returned by Drain when the cluster has no Host resources to cordon
+var errDrainUnsupported = errors.New("the Host resource is not served by the cluster, hosts cannot be drained")
+
+func (hostGroup *HostgroupConfig) newCmdDrain() *cobra.Command {
+	var timeout time.Duration
+	var undo bool
+
+	cmd := &cobra.Command{
+		Use:   "drain <name> [flags]",
+		Short: "Move the workloads of a hostgroup to other hostgroups",
+		Long: `Mark the hosts of a hostgroup unschedulable, then stop them one at a time by scaling the
+hostgroup workload down, waiting after each host for its components and providers to be placed
+on other hostgroups. The workloads that could not be moved before the timeout are reported and the
+remaining hosts keep running.
+
+The hostgroup stays scaled down until drain --undo restores its replica count, for instance after
+node maintenance. A hostgroup with an autoscaler cannot be drained.`,
+		Example: `  # empty a hostgroup before maintenance, then let it take workloads again
+  kubectl cosmo hostgroup drain hostgroup --timeout 10m
+  kubectl cosmo hostgroup drain hostgroup --undo`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := hostGroup.Initialize(cmd, args); err != nil {
+				return err
+			}
+
+			if undo {
+				return hostGroup.Undrain(cmd.Context(), args[0])
+			}
+			return hostGroup.Drain(cmd.Context(), args[0], timeout, false)
+		},
+	}
+
+	cmd.Flags().DurationVar(&timeout, "timeout", 5*time.Minute, "how long to wait for the workloads to move")
+	cmd.Flags().BoolVar(&undo, "undo", false, "restore the hosts of a drained hostgroup")
+
+	return cmd
+}
+
+// Drain cordons the Host resources of the hostgroup release and stops its hosts one at a time, waiting
+// after each for the components and providers it ran to be placed again. With removeAutoscaler the
+// autoscalers hostgroup autoscale created are deleted once the hostgroup is known to be drainable,
+// right before it is scaled down, instead of failing the drain.
+func (hostGroup *HostgroupConfig) Drain(ctx context.Context, releaseName string, timeout time.Duration, removeAutoscaler bool) error {
+	// an autoscaler would start the stopped hosts again
+	if !removeAutoscaler {
+		if err := hostGroup.checkNoAutoscaler(ctx, releaseName); err != nil {
+			return err
+		}
+	}
+
+	client, _, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+	dyn, err := newDynamicClient()
+	if err != nil {
+		return err
+	}
+	namespace := hostGroup.manager.Namespace()
+
+	hosts, count, err := hostGroup.cordon(ctx, client, dyn, releaseName, true)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		fmt.Fprintf(hostGroup.Out, "hostgroup %s has no hosts to drain\n", releaseName)
+		return nil
+	}
+
+	moving, err := workloadsOnHosts(ctx, client, dyn, hosts)
+	if err != nil {
+		return err
+	}
+
+	target, err := scaleTarget(ctx, client, namespace, releaseName)
+	if err != nil {
+		return err
+	}
+
+	// failed names the autoscalers removed for the drain, so they can be recreated if it is given up
+	var removed []string
+	failed := func(err error) error {
+		if len(removed) == 0 {
+			return err
+		}
+		return fmt.Errorf("%w; the %s of %s was removed, recreate it with hostgroup autoscale", err, strings.Join(removed, " and "), releaseName)
+	}
+	if removeAutoscaler {
+		hasKeda := hasResource(client, scaledObjectResource.GroupVersion().String(), scaledObjectResource.Resource)
+		removed, err = removeAutoscalers(ctx, client, dyn, namespace, releaseName, hasKeda)
+		if err != nil {
+			return fmt.Errorf("failed to remove the autoscaler of hostgroup %s: %w", releaseName, err)
+		}
+		if len(removed) > 0 {
+			fmt.Fprintf(hostGroup.Out, "removed %s of hostgroup %s\n", strings.Join(removed, " and "), releaseName)
+		}
+		// an autoscaler hostgroup autoscale did not create is left to its owner
+		if err := hostGroup.checkNoAutoscaler(ctx, releaseName); err != nil {
+			return failed(err)
+		}
+	}
+
+	replicas, err := targetReplicas(ctx, client, namespace, target)
+	if err != nil {
+		return failed(err)
+	}
+	if err := rememberReplicas(ctx, dyn, namespace, target, replicas); err != nil {
+		return failed(err)
+	}
+	fmt.Fprintf(hostGroup.Out, "hostgroup %s cordoned, stopping %d hosts running %d workloads\n", releaseName, replicas, len(moving))
+
+	deadline := time.Now().Add(timeout)
+	for replicas > 0 {
+		replicas--
+		if err := scaleTargetTo(ctx, dyn, namespace, target, replicas); err != nil {
+			return failed(err)
+		}
+		if err := waitForHostsStopped(ctx, client, namespace, releaseName, hosts, int(replicas), time.Until(deadline)); err != nil {
+			return failed(fmt.Errorf("%w, %s keeps %d hosts until drain --undo", err, releaseName, replicas+1))
+		}
+		if err := waitForWorkloadsPlaced(ctx, client, dyn, moving, time.Until(deadline), hostGroup.Out); err != nil {
+			hostGroup.reportUnmoved(ctx, client, dyn, hosts)
+			return failed(fmt.Errorf("%w, %s keeps %d hosts until drain --undo", err, releaseName, replicas))
+		}
+		fmt.Fprintf(hostGroup.Out, "  host stopped, %d left\n", replicas)
+	}
+
+	fmt.Fprintf(hostGroup.Out, "hostgroup %s drained\n", releaseName)
+	return nil
+}
+
+// checkNoAutoscaler fails when the hostgroup release is scaled by an autoscaler
+func (hostGroup *HostgroupConfig) checkNoAutoscaler(ctx context.Context, releaseName string) error {
+	kind, err := hostGroup.autoscalerKind(ctx, releaseName)
+	if err != nil {
+		return err
+	}
+	if kind != "" {
+		return fmt.Errorf("hostgroup %s is scaled by a %s, remove it with hostgroup autoscale --off first", releaseName, kind)
+	}
+	return nil
+}
+
+// reportUnmoved prints the workloads still reported on the drained hosts
+func (hostGroup *HostgroupConfig) reportUnmoved(ctx context.Context, client kubernetes.Interface, dyn dynamic.Interface, hosts map[string]bool) {
+	var remaining []string
+	err := eachWorkload(ctx, client, dyn, func(kind string, workload workloadInfo) {
+		var on []string
+		for _, host := range workload.Hosts {
+			if hosts[host] {
+				on = append(on, host)
+			}
+		}
+		if len(on) > 0 {
+			remaining = append(remaining, fmt.Sprintf("%s on %s", workloadKey(kind, workload), strings.Join(on, ",")))
+		}
+	})
+	if err != nil || len(remaining) == 0 {
+		return
+	}
+
+	sort.Strings(remaining)
+	fmt.Fprintln(hostGroup.ErrOut, "could not be moved:")
+	for _, workload := range remaining {
+		fmt.Fprintf(hostGroup.ErrOut, "  %s\n", workload)
+	}
+}
+
+// Undrain uncordons the hosts of the hostgroup release and restores the replica count it had before
+// it was drained
+func (hostGroup *HostgroupConfig) Undrain(ctx context.Context, releaseName string) error {
+	client, _, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+	dyn, err := newDynamicClient()
+	if err != nil {
+		return err
+	}
+	namespace := hostGroup.manager.Namespace()
+
+	if _, _, err := hostGroup.cordon(ctx, client, dyn, releaseName, false); err != nil && !errors.Is(err, errDrainUnsupported) {
+		return err
+	}
+
+	target, err := scaleTarget(ctx, client, namespace, releaseName)
+	if err != nil {
+		return err
+	}
+	object, err := dyn.Resource(targetResource(target)).Namespace(namespace).Get(ctx, target.Name, v1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	value, ok := object.GetAnnotations()[drainedReplicasAnnotation]
+	if !ok {
+		fmt.Fprintf(hostGroup.Out, "hostgroup %s schedulable again, it was not scaled down by drain\n", releaseName)
+		return nil
+	}
+	replicas, err := strconv.ParseInt(value, 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid %s annotation on %s %s: %w", drainedReplicasAnnotation, strings.ToLower(target.Kind), target.Name, err)
+	}
+
+	if err := scaleTargetTo(ctx, dyn, namespace, target, int32(replicas)); err != nil {
+		return err
+	}
+	if err := patchAnnotation(ctx, dyn, namespace, target, nil); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(hostGroup.Out, "hostgroup %s restored to %d hosts\n", releaseName, replicas)
+	return nil
+}
+
+// cordon marks the Host resources running in the pods of the release unschedulable, or clears the
+// mark. It returns the names the hosts are referred to by, the Host resource and pod names and the
+// host IDs, and the number of hosts. Pods of the release without a Host resource are an error, as
+// the workloads placed on them could not be told apart.
+func (hostGroup *HostgroupConfig) cordon(ctx context.Context, client kubernetes.Interface, dyn dynamic.Interface, releaseName string, unschedulable bool) (map[string]bool, int, error) {
+	hostResource, found, err := cosmonicResource(client, "Host")
+	if err != nil {
+		return nil, 0, err
+	}
+	if !found {
+		return nil, 0, errDrainUnsupported
+	}
+
+	namespace := hostGroup.manager.Namespace()
+	pods, err := client.CoreV1().Pods(namespace).List(ctx, v1.ListOptions{LabelSelector: releaseSelector(releaseName)})
+	if err != nil {
+		return nil, 0, err
+	}
+	hostObjects, err := dyn.Resource(hostResource).Namespace(namespace).List(ctx, v1.ListOptions{})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	inRelease := map[string]bool{}
+	for _, pod := range pods.Items {
+		inRelease[pod.Name] = true
+	}
+
+	action := "uncordon"
+	var patch map[string]interface{}
+	if unschedulable {
+		action = "cordon"
+		patch = map[string]interface{}{
+			"metadata": map[string]interface{}{"labels": map[string]interface{}{drainLabel: "true"}},
+			"spec":     map[string]interface{}{"unschedulable": true},
+		}
+	} else {
+		patch = map[string]interface{}{
+			"metadata": map[string]interface{}{"labels": map[string]interface{}{drainLabel: nil}},
+			"spec":     map[string]interface{}{"unschedulable": nil},
+		}
+	}
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	hosts := map[string]bool{}
+	count := 0
+	var notKept []string
+	for i := range hostObjects.Items {
+		object := &hostObjects.Items[i]
+		podName := hostPodName(object)
+		if !inRelease[podName] {
+			continue
+		}
+
+		patched, err := dyn.Resource(hostResource).Namespace(namespace).Patch(ctx, object.GetName(), types.MergePatchType, data, v1.PatchOptions{})
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to %s host %s: %w", action, object.GetName(), err)
+		}
+		// a Host schema without the field prunes it, leaving the host placeable
+		if kept, _, _ := unstructured.NestedBool(patched.Object, "spec", "unschedulable"); unschedulable && !kept {
+			notKept = append(notKept, object.GetName())
+		}
+
+		hosts[object.GetName()] = true
+		hosts[podName] = true
+		if id := firstNestedString(object, []string{"status", "hostId"}, []string{"spec", "hostId"}); id != "" {
+			hosts[id] = true
+		}
+		count++
+	}
+
+	if len(pods.Items) > 0 && count == 0 && unschedulable {
+		return nil, 0, fmt.Errorf("none of the %d pods of hostgroup %s has a Host resource, the workloads on them cannot be tracked", len(pods.Items), releaseName)
+	}
+	if len(notKept) > 0 {
+		fmt.Fprintf(hostGroup.ErrOut, "warning: the Host resources do not keep spec.unschedulable, workloads may be placed on %s until it stops\n", strings.Join(notKept, ", "))
+	}
+
+	return hosts, count, nil
+}
+
+// workloadsOnHosts are the components and providers placed on any of the hosts, as kind namespace/name
+func workloadsOnHosts(ctx context.Context, client kubernetes.Interface, dyn dynamic.Interface, hosts map[string]bool) (map[string]bool, error) {
+	on := map[string]bool{}
+	err := eachWorkload(ctx, client, dyn, func(kind string, workload workloadInfo) {
+		for _, host := range workload.Hosts {
+			if hosts[host] {
+				on[workloadKey(kind, workload)] = true
+				return
+			}
+		}
+	})
+	return on, err
+}
+
+// waitForHostsStopped polls until at most replicas of the hosts still have a pod
+func waitForHostsStopped(ctx context.Context, client kubernetes.Interface, namespace string, releaseName string, hosts map[string]bool, replicas int, timeout time.Duration) error {
+	err := wait.PollUntilContextTimeout(ctx, 2*time.Second, timeout, true, func(ctx context.Context) (bool, error) {
+		pods, err := client.CoreV1().Pods(namespace).List(ctx, v1.ListOptions{LabelSelector: releaseSelector(releaseName)})
+		if err != nil {
+			return false, err
+		}
+		running := 0
+		for _, pod := range pods.Items {
+			if hosts[pod.Name] {
+				running++
+			}
+		}
+		return running <= replicas, nil
+	})
+	if err != nil {
+		return fmt.Errorf("hosts of %s did not stop: %w", releaseName, err)
+	}
+	return nil
+}
+
+// targetResource is the resource of the deployment or statefulset a hostgroup runs its hosts in
+func targetResource(target *autoscalingv2.CrossVersionObjectReference) schema.GroupVersionResource {
+	return schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: strings.ToLower(target.Kind) + "s"}
+}
+
+// scaleTargetTo sets the replicas of the target through its scale subresource
+func scaleTargetTo(ctx context.Context, dyn dynamic.Interface, namespace string, target *autoscalingv2.CrossVersionObjectReference, replicas int32) error {
+	data, err := json.Marshal(map[string]interface{}{"spec": map[string]interface{}{"replicas": replicas}})
+	if err != nil {
+		return err
+	}
+	_, err = dyn.Resource(targetResource(target)).Namespace(namespace).Patch(ctx, target.Name, types.MergePatchType, data, v1.PatchOptions{}, "scale")
+	if err != nil {
+		return fmt.Errorf("failed to scale %s %s: %w", strings.ToLower(target.Kind), target.Name, err)
+	}
+	return nil
+}
+
+// rememberReplicas records the replica count the target is restored to by drain --undo, keeping the
+// count of an earlier drain that was interrupted
+func rememberReplicas(ctx context.Context, dyn dynamic.Interface, namespace string, target *autoscalingv2.CrossVersionObjectReference, replicas int32) error {
+	object, err := dyn.Resource(targetResource(target)).Namespace(namespace).Get(ctx, target.Name, v1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if _, ok := object.GetAnnotations()[drainedReplicasAnnotation]; ok {
+		return nil
+	}
+	value := strconv.Itoa(int(replicas))
+	return patchAnnotation(ctx, dyn, namespace, target, &value)
+}
+
+// patchAnnotation sets the drained replicas annotation of the target, or removes it when value is nil
+func patchAnnotation(ctx context.Context, dyn dynamic.Interface, namespace string, target *autoscalingv2.CrossVersionObjectReference, value *string) error {
+	data, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": map[string]interface{}{drainedReplicasAnnotation: value}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = dyn.Resource(targetResource(target)).Namespace(namespace).Patch(ctx, target.Name, types.MergePatchType, data, v1.PatchOptions{})
+	return err
+}
@@ -0,0 +1,313 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	chartManager "github.com/cosmonic/kubectl-cosmo/pkg/internal/chartmanager"
+	"helm.sh/helm/v3/pkg/chartutil"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// strategyRolling upgrades the hostgroups in batches, waiting for each batch to be healthy
+	strategyRolling = "rolling"
+	// strategyAllAtOnce upgrades every hostgroup at once and checks their health afterwards
+	strategyAllAtOnce = "all-at-once"
+)
+
+// hostgroupUpdateFlags select the hostgroup releases to update and how they are rolled out
+type hostgroupUpdateFlags struct {
+	all          bool
+	strategy     string
+	maxParallel  int
+	pauseBetween time.Duration
+	timeout      time.Duration
+}
+
+// validate checks the rollout flags
+func (f *hostgroupUpdateFlags) validate(names []string) error {
+	if f.all && len(names) > 0 {
+		return errors.New("--all cannot be combined with hostgroup names")
+	}
+	if f.strategy != strategyRolling && f.strategy != strategyAllAtOnce {
+		return fmt.Errorf("invalid --strategy %q, must be %s or %s", f.strategy, strategyRolling, strategyAllAtOnce)
+	}
+	if f.maxParallel < 1 {
+		return fmt.Errorf("invalid --max-parallel %d, must be at least 1", f.maxParallel)
+	}
+	if f.pauseBetween < 0 {
+		return fmt.Errorf("invalid --pause-between %s", f.pauseBetween)
+	}
+	return nil
+}
+
+// UpdateReleases upgrades the named hostgroups, or every hostgroup with --all, to the latest chart
+// version. Each batch is waited on until its hosts are ready and the workloads that ran on them are
+// placed again, and the rollout stops at the first failure.
+func (hostGroup *HostgroupConfig) UpdateReleases(ctx context.Context, names []string, opts chartManager.ReleaseOptions) error {
+	flags := &hostGroup.updateFlags
+
+	releases := names
+	if flags.all {
+		var err error
+		if releases, err = hostGroup.manager.ListReleases(hostgroupRepoChartName); err != nil {
+			return err
+		}
+		if len(releases) == 0 {
+			return errors.New("no hostgroups are installed")
+		}
+		sort.Strings(releases)
+	}
+	if len(releases) == 0 {
+		releases = []string{hostgroupInstalledChartName}
+	}
+
+	client, _, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+	dyn, err := newDynamicClient()
+	if err != nil {
+		return err
+	}
+
+	batchSize := flags.maxParallel
+	if flags.strategy == strategyAllAtOnce {
+		batchSize = len(releases)
+	}
+
+	var upgraded, upToDate []string
+	for start := 0; start < len(releases); start += batchSize {
+		batch := releases[start:min(start+batchSize, len(releases))]
+		fmt.Fprintf(hostGroup.Out, "[%d/%d] upgrading %s...\n", start+len(batch), len(releases), strings.Join(batch, ", "))
+
+		remaining := releases[start+len(batch):]
+
+		// only the workloads on the hosts being replaced have to be placed again
+		scope := map[string]bool{}
+		for _, releaseName := range batch {
+			hosts, err := releaseHosts(ctx, client, dyn, hostGroup.manager.Namespace(), releaseName)
+			if err != nil {
+				return hostGroup.rolloutFailed(err, upgraded, remaining)
+			}
+			on, err := workloadsOnHosts(ctx, client, dyn, hosts)
+			if err != nil {
+				return hostGroup.rolloutFailed(err, upgraded, remaining)
+			}
+			for key := range on {
+				scope[key] = true
+			}
+		}
+
+		changed, err := hostGroup.upgradeBatch(ctx, batch, opts)
+		if err != nil {
+			return hostGroup.rolloutFailed(err, upgraded, remaining)
+		}
+		for _, releaseName := range batch {
+			if !slices.Contains(changed, releaseName) {
+				upToDate = append(upToDate, releaseName)
+			}
+		}
+		if len(changed) == 0 {
+			continue
+		}
+
+		for _, releaseName := range changed {
+			if err := waitForRelease(ctx, client, hostGroup.manager.Namespace(), releaseName, flags.timeout); err != nil {
+				return hostGroup.rolloutFailed(err, upgraded, remaining)
+			}
+		}
+		if err := waitForWorkloadsPlaced(ctx, client, dyn, scope, flags.timeout, hostGroup.Out); err != nil {
+			return hostGroup.rolloutFailed(err, upgraded, remaining)
+		}
+		upgraded = append(upgraded, changed...)
+
+		if flags.pauseBetween > 0 && len(remaining) > 0 {
+			fmt.Fprintf(hostGroup.Out, "  pausing %s before the next hostgroup\n", flags.pauseBetween)
+			select {
+			case <-ctx.Done():
+				return hostGroup.rolloutFailed(ctx.Err(), upgraded, remaining)
+			case <-time.After(flags.pauseBetween):
+			}
+		}
+	}
+
+	if len(upToDate) > 0 {
+		fmt.Fprintf(hostGroup.Out, "already at the latest version: %s\n", strings.Join(upToDate, ", "))
+	}
+	fmt.Fprintf(hostGroup.Out, "%d hostgroups upgraded\n", len(upgraded))
+	return nil
+}
+
+// upgradeBatch upgrades the releases concurrently, returning the ones that were upgraded. Releases
+// already at the latest version are skipped. The replicas of autoscaled releases are kept.
+func (hostGroup *HostgroupConfig) upgradeBatch(ctx context.Context, batch []string, opts chartManager.ReleaseOptions) ([]string, error) {
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		changed []string
+		errs    []error
+	)
+
+	for _, releaseName := range batch {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := hostGroup.updateRelease(ctx, releaseName, opts)
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case errors.Is(err, chartManager.ErrUpToDate):
+			case err != nil:
+				errs = append(errs, fmt.Errorf("%s: %w", releaseName, err))
+			default:
+				changed = append(changed, releaseName)
+			}
+		}()
+	}
+	wg.Wait()
+
+	sort.Strings(changed)
+	return changed, errors.Join(errs...)
+}
+
+// updateRelease upgrades the release to the latest chart version, pinning its replicas while an
+// autoscaler scales it
+func (hostGroup *HostgroupConfig) updateRelease(ctx context.Context, releaseName string, opts chartManager.ReleaseOptions) error {
+	rel, err := hostGroup.manager.GetRelease(releaseName)
+	if err != nil {
+		return err
+	}
+
+	values := map[string]interface{}{}
+	if err := hostGroup.pinAutoscaledReplicas(ctx, releaseName, rel.Chart, values); err != nil {
+		return err
+	}
+	opts.Values = chartutil.MergeTables(values, opts.Values)
+
+	return hostGroup.manager.Update(releaseName, hostgroupRepoChartName, opts)
+}
+
+// rolloutFailed reports how far the rollout got alongside the error that stopped it, the releases
+// of the failed batch being named by the error
+func (hostGroup *HostgroupConfig) rolloutFailed(err error, upgraded []string, remaining []string) error {
+	if len(upgraded) > 0 {
+		fmt.Fprintf(hostGroup.ErrOut, "upgraded: %s\n", strings.Join(upgraded, ", "))
+	}
+	if len(remaining) > 0 {
+		fmt.Fprintf(hostGroup.ErrOut, "not started: %s\n", strings.Join(remaining, ", "))
+	}
+	return fmt.Errorf("rollout stopped: %w", err)
+}
+
+// releaseHosts are the names the hosts of the release are referred to by in workload placements: the
+// pod names and, when the cluster serves Host resources, their names and host IDs
+func releaseHosts(ctx context.Context, client kubernetes.Interface, dyn dynamic.Interface, namespace string, releaseName string) (map[string]bool, error) {
+	pods, err := client.CoreV1().Pods(namespace).List(ctx, v1.ListOptions{LabelSelector: releaseSelector(releaseName)})
+	if err != nil {
+		return nil, err
+	}
+	hosts := map[string]bool{}
+	for _, pod := range pods.Items {
+		hosts[pod.Name] = true
+	}
+
+	hostResource, found, err := cosmonicResource(client, "Host")
+	if err != nil || !found {
+		return hosts, err
+	}
+	hostObjects, err := dyn.Resource(hostResource).Namespace(namespace).List(ctx, v1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for i := range hostObjects.Items {
+		object := &hostObjects.Items[i]
+		if !hosts[hostPodName(object)] {
+			continue
+		}
+		hosts[object.GetName()] = true
+		if id := firstNestedString(object, []string{"status", "hostId"}, []string{"spec", "hostId"}); id != "" {
+			hosts[id] = true
+		}
+	}
+	return hosts, nil
+}
+
+// waitForWorkloadsPlaced polls until the components and providers in scope, or all of them when scope
+// is nil, have all their replicas ready, so workloads moved off stopped hosts have been placed again
+func waitForWorkloadsPlaced(ctx context.Context, client kubernetes.Interface, dyn dynamic.Interface, scope map[string]bool, timeout time.Duration, progress io.Writer) error {
+	var pending []string
+	lastCount := -1
+	err := wait.PollUntilContextTimeout(ctx, 2*time.Second, timeout, true, func(ctx context.Context) (bool, error) {
+		var err error
+		if pending, err = unplacedWorkloads(ctx, client, dyn, scope); err != nil {
+			return false, err
+		}
+		if count := len(pending); count > 0 && count != lastCount {
+			fmt.Fprintf(progress, "  waiting for %d workloads to be placed\n", count)
+			lastCount = count
+		}
+		return len(pending) == 0, nil
+	})
+	if err != nil && len(pending) > 0 {
+		return fmt.Errorf("workloads were not placed again: %s: %w", strings.Join(pending, ", "), err)
+	}
+	return err
+}
+
+// unplacedWorkloads lists the components and providers in scope with fewer ready replicas than
+// desired, as kind namespace/name
+func unplacedWorkloads(ctx context.Context, client kubernetes.Interface, dyn dynamic.Interface, scope map[string]bool) ([]string, error) {
+	var pending []string
+	err := eachWorkload(ctx, client, dyn, func(kind string, workload workloadInfo) {
+		key := workloadKey(kind, workload)
+		if scope != nil && !scope[key] {
+			return
+		}
+		if workload.ReadyReplicas < workload.Replicas {
+			pending = append(pending, key)
+		}
+	})
+	return pending, err
+}
+
+// workloadKey names a component or provider as kind namespace/name
+func workloadKey(kind string, workload workloadInfo) string {
+	return fmt.Sprintf("%s %s/%s", strings.ToLower(kind), workload.Namespace, workload.Name)
+}
+
+// eachWorkload calls fn with every component and provider in the cluster. Kinds the cluster does not
+// serve are skipped.
+func eachWorkload(ctx context.Context, client kubernetes.Interface, dyn dynamic.Interface, fn func(kind string, workload workloadInfo)) error {
+	for _, kind := range []string{"Component", "Provider"} {
+		resource, found, err := cosmonicResource(client, kind)
+		if err != nil {
+			return err
+		}
+		if !found {
+			continue
+		}
+
+		list, err := dyn.Resource(resource).Namespace(v1.NamespaceAll).List(ctx, v1.ListOptions{})
+		if err != nil {
+			return err
+		}
+		for i := range list.Items {
+			fn(kind, newWorkloadInfo(&list.Items[i]))
+		}
+	}
+	return nil
+}
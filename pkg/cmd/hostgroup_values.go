@@ -0,0 +1,352 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	chartManager "github.com/cosmonic/kubectl-cosmo/pkg/internal/chartmanager"
+	"github.com/spf13/cobra"
+	"helm.sh/helm/v3/pkg/chart"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/yaml"
+)
+
+// hostgroupSetFlags are the placement overrides of hostgroup set
+type hostgroupSetFlags struct {
+	nodeSelector map[string]string
+	tolerations  []string
+	affinity     string
+	resources    map[string]string
+}
+
+func (hostGroup *HostgroupConfig) newCmdScale() *cobra.Command {
+	var replicas int
+	var flags releaseFlags
+
+	cmd := &cobra.Command{
+		Use:   "scale <name> --replicas N",
+		Short: "Set the number of hosts of a hostgroup",
+		Example: `  # run five hosts in the default hostgroup
+  kubectl cosmo hostgroup scale hostgroup --replicas 5`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := hostGroup.Initialize(cmd, args); err != nil {
+				return err
+			}
+			if replicas < 0 {
+				return fmt.Errorf("invalid --replicas %d", replicas)
+			}
+
+			opts, err := flags.options()
+			if err != nil {
+				return err
+			}
+
+			// an autoscaler would undo the new replica count right away
+			if kind, err := hostGroup.autoscalerKind(cmd.Context(), args[0]); err != nil {
+				return err
+			} else if kind != "" {
+				return fmt.Errorf("hostgroup %s is scaled by a %s, change its bounds with hostgroup autoscale or remove it with --off first", args[0], kind)
+			}
+
+			err = hostGroup.upgradeWithValues(cmd.Context(), args[0], opts, func(chrt *chart.Chart, existing map[string]interface{}) error {
+				path, err := chartValuePath(chrt, "replicaCount", "replicas")
+				if err != nil {
+					return err
+				}
+				setValue(existing, path, replicas)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(hostGroup.Out, "hostgroup %s scaled to %d replicas\n", args[0], replicas)
+			return nil
+		},
+	}
+	flags.addFlags(cmd.Flags())
+	cmd.Flags().IntVar(&replicas, "replicas", 0, "number of hosts")
+	cmd.MarkFlagRequired("replicas")
+
+	return cmd
+}
+
+func (hostGroup *HostgroupConfig) newCmdSet() *cobra.Command {
+	set := &hostgroupSetFlags{}
+	var flags releaseFlags
+
+	cmd := &cobra.Command{
+		Use:   "set <name> [flags]",
+		Short: "Change where the hosts of a hostgroup are scheduled and the resources they get",
+		Long: `Change the node selector, tolerations, affinity or resources of a hostgroup. The flags are
+translated into chart values and applied with a helm upgrade that keeps the other values and the
+installed chart version. Each flag replaces the previous value as a whole.`,
+		Example: `  # move the hostgroup onto the wasm node pool
+  kubectl cosmo hostgroup set hostgroup --node-selector pool=wasm --tolerations dedicated=wasm:NoSchedule
+
+  # size the hosts
+  kubectl cosmo hostgroup set hostgroup --resources requests.cpu=500m,requests.memory=512Mi,limits.memory=1Gi
+
+  # spread the hosts with an affinity read from a file
+  kubectl cosmo hostgroup set hostgroup --affinity affinity.yaml`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := hostGroup.Initialize(cmd, args); err != nil {
+				return err
+			}
+
+			placement, err := set.values(cmd)
+			if err != nil {
+				return err
+			}
+
+			opts, err := flags.options()
+			if err != nil {
+				return err
+			}
+
+			err = hostGroup.upgradeWithValues(cmd.Context(), args[0], opts, func(chrt *chart.Chart, existing map[string]interface{}) error {
+				for key, value := range placement {
+					path, err := chartValuePath(chrt, key)
+					if err != nil {
+						return err
+					}
+					setValue(existing, path, value)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(hostGroup.Out, "hostgroup %s updated\n", args[0])
+			return nil
+		},
+	}
+	flags.addFlags(cmd.Flags())
+	cmd.Flags().StringToStringVar(&set.nodeSelector, "node-selector", nil, "node labels the hosts must be scheduled on, as key=value pairs")
+	cmd.Flags().StringArrayVar(&set.tolerations, "tolerations", nil, "taint the hosts tolerate, as key[=value]:effect, can be repeated")
+	cmd.Flags().StringVar(&set.affinity, "affinity", "", "pod affinity of the hosts, as YAML or JSON or a file holding it")
+	cmd.Flags().StringToStringVar(&set.resources, "resources", nil, "resources of the hosts, as requests.<name>=quantity and limits.<name>=quantity pairs")
+
+	return cmd
+}
+
+// values converts the flags that were given to chart values, keyed by their usual top-level name
+func (set *hostgroupSetFlags) values(cmd *cobra.Command) (map[string]interface{}, error) {
+	overrides := map[string]interface{}{}
+
+	if cmd.Flags().Changed("node-selector") {
+		nodeSelector := map[string]interface{}{}
+		for k, v := range set.nodeSelector {
+			nodeSelector[k] = v
+		}
+		overrides["nodeSelector"] = nodeSelector
+	}
+
+	if cmd.Flags().Changed("tolerations") {
+		var tolerations []corev1.Toleration
+		for _, spec := range set.tolerations {
+			toleration, err := parseToleration(spec)
+			if err != nil {
+				return nil, err
+			}
+			tolerations = append(tolerations, toleration)
+		}
+		value, err := toValues(tolerations)
+		if err != nil {
+			return nil, err
+		}
+		overrides["tolerations"] = value
+	}
+
+	if cmd.Flags().Changed("affinity") {
+		data := []byte(set.affinity)
+		if content, err := os.ReadFile(set.affinity); err == nil {
+			data = content
+		}
+
+		affinity := &corev1.Affinity{}
+		if err := yaml.UnmarshalStrict(data, affinity); err != nil {
+			return nil, fmt.Errorf("invalid --affinity: %w", err)
+		}
+		value, err := toValues(affinity)
+		if err != nil {
+			return nil, err
+		}
+		overrides["affinity"] = value
+	}
+
+	if cmd.Flags().Changed("resources") {
+		resources, err := parseResources(set.resources)
+		if err != nil {
+			return nil, err
+		}
+		value, err := toValues(resources)
+		if err != nil {
+			return nil, err
+		}
+		overrides["resources"] = value
+	}
+
+	if len(overrides) == 0 {
+		return nil, errors.New("nothing to set, pass at least one of --node-selector, --tolerations, --affinity or --resources")
+	}
+	return overrides, nil
+}
+
+// upgradeWithValues upgrades the hostgroup release at its installed chart version with its existing
+// values, after override has set its values into them. Each overridden value is replaced as a whole,
+// so a node selector or toleration list that was set before does not linger.
+func (hostGroup *HostgroupConfig) upgradeWithValues(ctx context.Context, releaseName string, opts chartManager.ReleaseOptions, override func(chrt *chart.Chart, existing map[string]interface{}) error) error {
+	rel, err := hostGroup.manager.GetRelease(releaseName)
+	if errors.Is(err, chartManager.ErrReleaseNotFound) {
+		return fmt.Errorf("hostgroup %s is not installed", releaseName)
+	}
+	if err != nil {
+		return err
+	}
+	if rel.Chart == nil || rel.Chart.Metadata == nil || rel.Chart.Metadata.Name != hostgroupRepoChartName {
+		return fmt.Errorf("release %s is not a hostgroup", releaseName)
+	}
+
+	existing := rel.Config
+	if existing == nil {
+		existing = map[string]interface{}{}
+	}
+	if err := override(rel.Chart, existing); err != nil {
+		return err
+	}
+	if err := hostGroup.pinAutoscaledReplicas(ctx, releaseName, rel.Chart, existing); err != nil {
+		return err
+	}
+	opts.Values = existing
+	opts.Version = rel.Chart.Metadata.Version
+
+	return hostGroup.manager.UpgradeRelease(ctx, releaseName, hostgroupRepoChartName, opts)
+}
+
+// hostgroupValueParents are the maps the hostgroup chart may nest its pod settings in, subcharts
+// being left out so a value of theirs is never changed by mistake
+var hostgroupValueParents = []string{"hostgroup", "host"}
+
+// chartValuePath finds where the chart declares a value, in its default values or values schema: the
+// first of the keys at the top level, or otherwise under one of hostgroupValueParents such as
+// hostgroup.nodeSelector. A value the chart does not declare is an error as it would be ignored.
+func chartValuePath(chrt *chart.Chart, keys ...string) ([]string, error) {
+	for _, key := range keys {
+		if chartManager.HasValue(chrt, []string{key}) {
+			return []string{key}, nil
+		}
+	}
+	for _, parent := range hostgroupValueParents {
+		for _, key := range keys {
+			if path := []string{parent, key}; chartManager.HasValue(chrt, path) {
+				return path, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("chart %s %s has no %s value", chrt.Name(), chrt.Metadata.Version, keys[0])
+}
+
+// setValue sets the value at the path, creating the maps along it
+func setValue(values map[string]interface{}, path []string, value interface{}) {
+	for _, key := range path[:len(path)-1] {
+		nested, ok := values[key].(map[string]interface{})
+		if !ok {
+			nested = map[string]interface{}{}
+			values[key] = nested
+		}
+		values = nested
+	}
+	values[path[len(path)-1]] = value
+}
+
+// valuePaths are the dotted paths of the leaf values, sorted
+func valuePaths(values map[string]interface{}) []string {
+	var paths []string
+	for key, value := range values {
+		if nested, ok := value.(map[string]interface{}); ok && len(nested) > 0 {
+			for _, path := range valuePaths(nested) {
+				paths = append(paths, key+"."+path)
+			}
+			continue
+		}
+		paths = append(paths, key)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// parseToleration reads a toleration in the kubectl taint syntax, key[=value]:effect. A key without
+// a value tolerates the taint whatever its value, an empty effect every effect.
+func parseToleration(spec string) (corev1.Toleration, error) {
+	keyValue, effect, _ := strings.Cut(spec, ":")
+	key, value, hasValue := strings.Cut(keyValue, "=")
+
+	toleration := corev1.Toleration{Key: key, Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffect(effect)}
+	if hasValue {
+		toleration.Operator = corev1.TolerationOpEqual
+		toleration.Value = value
+	}
+
+	switch toleration.Effect {
+	case "", corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute:
+	default:
+		return toleration, fmt.Errorf("invalid toleration %q, effect must be NoSchedule, PreferNoSchedule or NoExecute", spec)
+	}
+	if key == "" && hasValue {
+		return toleration, fmt.Errorf("invalid toleration %q, a value needs a key", spec)
+	}
+	return toleration, nil
+}
+
+// parseResources reads requests.<name>=quantity and limits.<name>=quantity pairs
+func parseResources(pairs map[string]string) (*corev1.ResourceRequirements, error) {
+	resources := &corev1.ResourceRequirements{}
+	for key, value := range pairs {
+		kind, name, _ := strings.Cut(key, ".")
+		if name == "" {
+			return nil, fmt.Errorf("invalid resource %q, must be requests.<name> or limits.<name>", key)
+		}
+
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quantity for %s: %w", key, err)
+		}
+
+		switch kind {
+		case "requests":
+			if resources.Requests == nil {
+				resources.Requests = corev1.ResourceList{}
+			}
+			resources.Requests[corev1.ResourceName(name)] = quantity
+		case "limits":
+			if resources.Limits == nil {
+				resources.Limits = corev1.ResourceList{}
+			}
+			resources.Limits[corev1.ResourceName(name)] = quantity
+		default:
+			return nil, fmt.Errorf("invalid resource %q, must be requests.<name> or limits.<name>", key)
+		}
+	}
+	return resources, nil
+}
+
+// toValues converts a kubernetes type to the generic form helm values are in
+func toValues(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var values interface{}
+	err = json.Unmarshal(data, &values)
+	return values, err
+}
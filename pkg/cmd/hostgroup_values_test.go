@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chart"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestParseToleration(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    corev1.Toleration
+		wantErr bool
+	}{
+		{
+			spec: "dedicated=wasm:NoSchedule",
+			want: corev1.Toleration{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "wasm", Effect: corev1.TaintEffectNoSchedule},
+		},
+		{
+			spec: "dedicated:NoExecute",
+			want: corev1.Toleration{Key: "dedicated", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoExecute},
+		},
+		{
+			spec: "dedicated=wasm",
+			want: corev1.Toleration{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "wasm"},
+		},
+		{
+			spec: "dedicated",
+			want: corev1.Toleration{Key: "dedicated", Operator: corev1.TolerationOpExists},
+		},
+		{
+			spec: ":PreferNoSchedule",
+			want: corev1.Toleration{Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectPreferNoSchedule},
+		},
+		{spec: "dedicated=wasm:Sometimes", wantErr: true},
+		{spec: "=wasm:NoSchedule", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := parseToleration(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseToleration() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parseToleration() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseResources(t *testing.T) {
+	tests := []struct {
+		name    string
+		pairs   map[string]string
+		want    *corev1.ResourceRequirements
+		wantErr bool
+	}{
+		{
+			name:  "requests and limits",
+			pairs: map[string]string{"requests.cpu": "500m", "requests.memory": "512Mi", "limits.memory": "1Gi"},
+			want: &corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("500m"),
+					corev1.ResourceMemory: resource.MustParse("512Mi"),
+				},
+				Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")},
+			},
+		},
+		{
+			name:  "extended resource",
+			pairs: map[string]string{"limits.nvidia.com/gpu": "1"},
+			want:  &corev1.ResourceRequirements{Limits: corev1.ResourceList{"nvidia.com/gpu": resource.MustParse("1")}},
+		},
+		{name: "none", pairs: map[string]string{}, want: &corev1.ResourceRequirements{}},
+		{name: "no resource name", pairs: map[string]string{"requests": "1"}, wantErr: true},
+		{name: "unknown kind", pairs: map[string]string{"claims.cpu": "1"}, wantErr: true},
+		{name: "invalid quantity", pairs: map[string]string{"requests.cpu": "lots"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseResources(tt.pairs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseResources() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !equalResourceLists(got.Requests, tt.want.Requests) || !equalResourceLists(got.Limits, tt.want.Limits) {
+				t.Errorf("parseResources() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// equalResourceLists compares quantities by value, their cached string forms may differ
+func equalResourceLists(a, b corev1.ResourceList) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, quantity := range a {
+		other, ok := b[name]
+		if !ok || quantity.Cmp(other) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestChartValuePath(t *testing.T) {
+	tests := []struct {
+		name    string
+		chart   *chart.Chart
+		keys    []string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:  "top level",
+			chart: &chart.Chart{Values: map[string]interface{}{"replicaCount": 1, "hostgroup": map[string]interface{}{"replicas": 1}}},
+			keys:  []string{"replicaCount", "replicas"},
+			want:  []string{"replicaCount"},
+		},
+		{
+			name:  "nested under hostgroup",
+			chart: &chart.Chart{Values: map[string]interface{}{"hostgroup": map[string]interface{}{"nodeSelector": map[string]interface{}{}}}},
+			keys:  []string{"nodeSelector"},
+			want:  []string{"hostgroup", "nodeSelector"},
+		},
+		{
+			name:  "declared by the schema only",
+			chart: &chart.Chart{Schema: []byte(`{"properties":{"host":{"properties":{"tolerations":{"type":"array"}}}}}`)},
+			keys:  []string{"tolerations"},
+			want:  []string{"host", "tolerations"},
+		},
+		{
+			name:    "subchart value",
+			chart:   &chart.Chart{Values: map[string]interface{}{"nats": map[string]interface{}{"replicaCount": 3}}},
+			keys:    []string{"replicaCount", "replicas"},
+			wantErr: true,
+		},
+		{
+			name:    "undeclared",
+			chart:   &chart.Chart{Values: map[string]interface{}{"image": "host"}},
+			keys:    []string{"affinity"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.chart.Metadata = &chart.Metadata{Name: hostgroupRepoChartName, Version: "0.1.0"}
+			got, err := chartValuePath(tt.chart, tt.keys...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("chartValuePath() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("chartValuePath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValuePaths(t *testing.T) {
+	values := map[string]interface{}{
+		"nexus": map[string]interface{}{"url": "tls://nexus:4222", "remote": true},
+		"image": "host",
+		"empty": map[string]interface{}{},
+	}
+	want := []string{"empty", "image", "nexus.remote", "nexus.url"}
+	if got := valuePaths(values); !reflect.DeepEqual(got, want) {
+		t.Errorf("valuePaths() = %v, want %v", got, want)
+	}
+}
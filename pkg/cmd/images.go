@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	chartManager "github.com/cosmonic/kubectl-cosmo/pkg/internal/chartmanager"
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+)
+
+// componentImage is an image rendered by the chart of a component
+type componentImage struct {
+	Component string `json:"component"`
+	chartManager.Image
+}
+
+type ImagesConfig struct {
+	manager       *chartManager.ChartManager
+	configFlags   *genericclioptions.ConfigFlags
+	version       string
+	imageRegistry string
+	output        string
+	components    []string
+	genericiooptions.IOStreams
+
+	logger *log.Logger
+}
+
+func NewCmdImages(streams genericiooptions.IOStreams) *cobra.Command {
+	images := &ImagesConfig{configFlags: genericclioptions.NewConfigFlags(true), IOStreams: streams, logger: log.Default()}
+
+	cmd := &cobra.Command{
+		Use:         "images [command] [flags]",
+		Annotations: map[string]string{skipLicenseCheck: "true"},
+		Short:       "Inspect the container images used by Cosmonic Control",
+	}
+
+	listCmd := &cobra.Command{
+		Use:   "list [nexus|hostgroup] [flags]",
+		Short: "Lists every container image, with its digest, a chart version renders",
+		Example: `  # images of the latest release
+  kubectl cosmo images list
+
+  # images of the hostgroup chart as they would be pulled from a mirror
+  kubectl cosmo images list hostgroup --version 0.2.0 --image-registry registry.example.com/cosmonic`,
+		Args:      cobra.MaximumNArgs(1),
+		ValidArgs: []string{"nexus", "hostgroup"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := images.Initialize(cmd, args); err != nil {
+				return err
+			}
+			if err := images.Validate(); err != nil {
+				return err
+			}
+
+			return images.Run(cmd.Context())
+		},
+	}
+	listCmd.Flags().StringVar(&images.version, "version", "", "chart version (default the latest version in the registry)")
+	listCmd.Flags().StringVar(&images.imageRegistry, "image-registry", "", "list the images as rewritten to this mirror registry, digests are resolved from the mirror")
+	listCmd.Flags().StringVarP(&images.output, "output", "o", "", "output format, one of json or yaml")
+
+	cmd.AddCommand(listCmd)
+
+	return cmd
+}
+
+// Initialize configures the chart manager and the components to list
+func (images *ImagesConfig) Initialize(cmd *cobra.Command, args []string) error {
+	helmDriver := os.Getenv("HELM_DRIVER")
+	manager, err := chartManager.New(images.IOStreams, helmDriver, log.New(images.ErrOut, "", 0))
+	if err != nil {
+		return err
+	}
+	images.manager = manager
+
+	images.components = []string{"nexus", "hostgroup"}
+	if len(args) == 1 {
+		images.components = args
+	}
+
+	return nil
+}
+
+// Valdiate checks the configuration
+func (images *ImagesConfig) Validate() error {
+	for _, component := range images.components {
+		if component != "nexus" && component != "hostgroup" {
+			return fmt.Errorf("unknown component %q, must be nexus or hostgroup", component)
+		}
+	}
+	return validateOutputFormat(images.output)
+}
+
+// Run renders the chart of each component and prints its images
+func (images *ImagesConfig) Run(ctx context.Context) error {
+	var result []componentImage
+	for _, component := range images.components {
+		chartName := controlChartName
+		if component == "hostgroup" {
+			chartName = hostgroupRepoChartName
+		}
+
+		list, err := images.manager.ListImages(ctx, chartName, chartManager.ReleaseOptions{
+			Version:       images.version,
+			ImageRegistry: images.imageRegistry,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list %s images: %w", component, err)
+		}
+		for _, image := range list {
+			result = append(result, componentImage{Component: component, Image: image})
+		}
+	}
+
+	if images.output != "" {
+		return printStructured(images.Out, images.output, result)
+	}
+
+	w := tabwriter.NewWriter(images.Out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "COMPONENT\tIMAGE\tDIGEST")
+	for _, image := range result {
+		digest := image.Digest
+		if digest == "" {
+			digest = "<unresolved>"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", image.Component, image.Reference, digest)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,244 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cosmonic/kubectl-cosmo/pkg/internal/jointoken"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+	"k8s.io/client-go/kubernetes"
+)
+
+// joinCheckTimeout bounds the reachability check of a remote nexus endpoint
+const joinCheckTimeout = 10 * time.Second
+
+type JoinTokenConfig struct {
+	endpoint string
+	caFile   string
+	secret   string
+	genericiooptions.IOStreams
+}
+
+func newCmdJoinToken(streams genericiooptions.IOStreams) *cobra.Command {
+	joinToken := &JoinTokenConfig{IOStreams: streams}
+
+	cmd := &cobra.Command{
+		Use:   "join-token [command] [flags]",
+		Short: "Manage the tokens hostgroups in other clusters join the nexus with",
+	}
+
+	createCmd := &cobra.Command{
+		Use:   "create [flags]",
+		Short: "Print a join token holding the NATS endpoint, CA and credentials of the nexus",
+		Long: `Print a join token for this cluster's nexus. The token holds the externally reachable NATS
+endpoint, the CA its certificate is signed by and the credentials hosts connect with, and is
+consumed by 'kubectl cosmo hostgroup install --join' in another cluster.
+
+The credentials are read from the --secret secret. Create a dedicated NATS user for the remote
+hostgroup, limited to the subjects hosts use, rather than handing out the platform's own credentials.
+The token contains them, keep it secret.`,
+		Example: `  # endpoint taken from the NATS LoadBalancer service
+  kubectl cosmo nexus join-token create --secret remote-hosts-creds > join.token
+
+  # endpoint behind an ingress or DNS name of your own
+  kubectl cosmo nexus join-token create --secret remote-hosts-creds --endpoint tls://nats.example.com:4222 --ca-file ca.crt`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := joinToken.Validate(); err != nil {
+				return err
+			}
+
+			return joinToken.Run(cmd.Context())
+		},
+	}
+	createCmd.Flags().StringVar(&joinToken.endpoint, "endpoint", "", "NATS URL the remote hosts connect to (default the address of the NATS LoadBalancer service)")
+	createCmd.Flags().StringVar(&joinToken.caFile, "ca-file", "", fmt.Sprintf("PEM file of the CA the endpoint certificate is signed by (default the ca.crt of the secret in %s labeled %s=true, or of the only nexus secret holding one)", cosmonicNamespace, natsCALabel))
+	createCmd.Flags().StringVar(&joinToken.secret, "secret", "", fmt.Sprintf("secret in %s holding the NATS credentials the remote hosts connect with", cosmonicNamespace))
+	createCmd.MarkFlagRequired("secret")
+
+	cmd.AddCommand(createCmd)
+	return cmd
+}
+
+// Validate checks the endpoint is a NATS URL
+func (joinToken *JoinTokenConfig) Validate() error {
+	if joinToken.endpoint == "" {
+		return nil
+	}
+	_, err := (&jointoken.Bundle{Endpoint: joinToken.endpoint}).Address()
+	return err
+}
+
+// Run collects the endpoint, CA and credentials from the cluster and prints the token
+func (joinToken *JoinTokenConfig) Run(ctx context.Context) error {
+	client, _, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+
+	bundle := &jointoken.Bundle{Endpoint: joinToken.endpoint, IssuedAt: time.Now().UTC()}
+
+	if joinToken.caFile != "" {
+		if bundle.CA, err = os.ReadFile(joinToken.caFile); err != nil {
+			return err
+		}
+	} else if bundle.CA, err = natsCAFromSecrets(ctx, client); err != nil {
+		return err
+	}
+
+	if bundle.Endpoint == "" {
+		if bundle.Endpoint, err = natsExternalEndpoint(ctx, client, len(bundle.CA) > 0); err != nil {
+			return err
+		}
+	}
+
+	credentials, err := natsCredentialsFromSecret(ctx, client, joinToken.secret)
+	if err != nil {
+		return err
+	}
+	bundle.Credentials = credentials.credsFile()
+
+	token, err := jointoken.Encode(bundle)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(joinToken.ErrOut, "join token for %s\n", bundle.Endpoint)
+	fmt.Fprintln(joinToken.Out, token)
+	return nil
+}
+
+// natsExternalEndpoint is the NATS URL of the LoadBalancer service exposing the NATS client port
+func natsExternalEndpoint(ctx context.Context, client kubernetes.Interface, secure bool) (string, error) {
+	services, err := client.CoreV1().Services(cosmonicNamespace).List(ctx, v1.ListOptions{})
+	if err != nil {
+		return "", err
+	}
+	sort.Slice(services.Items, func(i, j int) bool { return services.Items[i].Name < services.Items[j].Name })
+
+	var loadBalancers []corev1.Service
+	for _, svc := range services.Items {
+		if svc.Spec.Type == corev1.ServiceTypeLoadBalancer {
+			loadBalancers = append(loadBalancers, svc)
+		}
+	}
+
+	svc, ports := findTargetService(loadBalancers, portForwardTargets["nats"], true)
+	if svc == nil {
+		return "", fmt.Errorf("no NATS LoadBalancer service found in namespace %s, pass --endpoint", cosmonicNamespace)
+	}
+
+	for _, ingress := range svc.Status.LoadBalancer.Ingress {
+		host := ingress.Hostname
+		if host == "" {
+			host = ingress.IP
+		}
+		if host == "" {
+			continue
+		}
+
+		scheme := "nats"
+		if secure {
+			scheme = "tls"
+		}
+		endpoint := url.URL{Scheme: scheme, Host: net.JoinHostPort(host, strconv.Itoa(int(ports[0].Port)))}
+		return endpoint.String(), nil
+	}
+	return "", fmt.Errorf("service %s has no external address yet, pass --endpoint", svc.Name)
+}
+
+// natsCALabel marks the secret in the install namespace holding the CA of the NATS certificate
+const natsCALabel = "cosmonic.io/nats-ca"
+
+// natsCAFromSecrets reads the ca.crt of the secret in the install namespace labeled
+// cosmonic.io/nats-ca=true, or else of the only secret of the nexus release holding a ca.crt. Several
+// candidates are an error so the wrong CA is never embedded in a token, and no CA is returned when
+// the platform has none.
+func natsCAFromSecrets(ctx context.Context, client kubernetes.Interface) ([]byte, error) {
+	labeled, err := client.CoreV1().Secrets(cosmonicNamespace).List(ctx, v1.ListOptions{LabelSelector: natsCALabel + "=true"})
+	if err != nil {
+		return nil, err
+	}
+	switch len(labeled.Items) {
+	case 0:
+	case 1:
+		ca := labeled.Items[0].Data[jointoken.CAKey]
+		if len(ca) == 0 {
+			return nil, fmt.Errorf("secret %s has no %s key", labeled.Items[0].Name, jointoken.CAKey)
+		}
+		return ca, nil
+	default:
+		return nil, fmt.Errorf("several secrets are labeled %s=true: %s, pass --ca-file", natsCALabel, strings.Join(secretNames(labeled.Items), ", "))
+	}
+
+	secrets, err := client.CoreV1().Secrets(cosmonicNamespace).List(ctx, v1.ListOptions{LabelSelector: releaseSelector(controlChartName)})
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []corev1.Secret
+	for _, secret := range secrets.Items {
+		if len(secret.Data[jointoken.CAKey]) > 0 {
+			candidates = append(candidates, secret)
+		}
+	}
+	if len(candidates) > 1 {
+		return nil, fmt.Errorf("several secrets of %s hold a %s: %s, pass --ca-file or label one %s=true", controlChartName, jointoken.CAKey, strings.Join(secretNames(candidates), ", "), natsCALabel)
+	}
+	if len(candidates) == 1 {
+		return candidates[0].Data[jointoken.CAKey], nil
+	}
+	return nil, nil
+}
+
+// credsFile is the credentials in the NATS creds file format
+func (credentials *natsCredentials) credsFile() []byte {
+	if len(credentials.creds) > 0 {
+		return credentials.creds
+	}
+	return []byte(fmt.Sprintf(`-----BEGIN NATS USER JWT-----
+%s
+------END NATS USER JWT------
+
+-----BEGIN USER NKEY SEED-----
+%s
+------END USER NKEY SEED------
+`, credentials.jwt, credentials.seed))
+}
+
+// readJoinToken reads the --join value, either a token or a file holding one
+func readJoinToken(value string) (*jointoken.Bundle, error) {
+	if jointoken.IsToken(value) {
+		return jointoken.Decode(value)
+	}
+
+	data, err := os.ReadFile(value)
+	if err != nil {
+		return nil, fmt.Errorf("--join is neither a join token nor a readable file: %w", err)
+	}
+	return jointoken.Decode(string(data))
+}
+
+// joinValues point the hostgroup chart at the remote nexus, the endpoint, CA and credentials being
+// read from the secret the bundle was stored in
+func joinValues(bundle *jointoken.Bundle, secretName string) map[string]interface{} {
+	return map[string]interface{}{
+		"nexus": map[string]interface{}{
+			"remote":   true,
+			"url":      bundle.Endpoint,
+			"secret":   secretName,
+			"caKey":    jointoken.CAKey,
+			"credsKey": jointoken.CredentialsKey,
+		},
+	}
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNatsCAFromSecrets(t *testing.T) {
+	secret := func(name string, labels map[string]string, ca string) *corev1.Secret {
+		s := &corev1.Secret{ObjectMeta: v1.ObjectMeta{Name: name, Namespace: cosmonicNamespace, Labels: labels}}
+		if ca != "" {
+			s.Data = map[string][]byte{"ca.crt": []byte(ca)}
+		}
+		return s
+	}
+	release := map[string]string{"app.kubernetes.io/instance": controlChartName}
+	labeled := map[string]string{natsCALabel: "true"}
+
+	tests := []struct {
+		name    string
+		objects []runtime.Object
+		want    string
+		wantErr bool
+	}{
+		{name: "no CA"},
+		{
+			name:    "unrelated secret named after NATS",
+			objects: []runtime.Object{secret("my-nats-tls", nil, "other")},
+		},
+		{
+			name:    "only release secret with a CA",
+			objects: []runtime.Object{secret("nats-tls", release, "nexus"), secret("nats-config", release, "")},
+			want:    "nexus",
+		},
+		{
+			name:    "several release secrets with a CA",
+			objects: []runtime.Object{secret("nats-tls", release, "nexus"), secret("webhook-tls", release, "webhook")},
+			wantErr: true,
+		},
+		{
+			name:    "labeled secret wins",
+			objects: []runtime.Object{secret("nats-tls", release, "nexus"), secret("webhook-tls", release, "webhook"), secret("custom-ca", labeled, "custom")},
+			want:    "custom",
+		},
+		{
+			name:    "labeled secret without a CA",
+			objects: []runtime.Object{secret("custom-ca", labeled, "")},
+			wantErr: true,
+		},
+		{
+			name:    "several labeled secrets",
+			objects: []runtime.Object{secret("a", labeled, "a"), secret("b", labeled, "b")},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := natsCAFromSecrets(context.Background(), fake.NewClientset(tt.objects...))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("natsCAFromSecrets() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("natsCAFromSecrets() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,262 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// componentNames are the Cosmonic components whose workloads can be looked up by name
+var componentNames = []string{"nexus", "hostgroup", "console"}
+
+// cosmonicAPIGroupSuffixes are the API groups the Cosmonic and wasmCloud custom resources are served from
+var cosmonicAPIGroupSuffixes = []string{"cosmonic.io", "wasmcloud.dev"}
+
+// newKubeConfig loads the rest config from the default kubeconfig loading rules
+func newKubeConfig() (*rest.Config, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	overrides := &clientcmd.ConfigOverrides{}
+
+	kubeConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+
+	return kubeConfig.ClientConfig()
+}
+
+// currentNamespace is the namespace of the current kubeconfig context, default when it sets none
+func currentNamespace() (string, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	kubeConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{})
+
+	namespace, _, err := kubeConfig.Namespace()
+	return namespace, err
+}
+
+// newKubeClient builds a clientset from the default kubeconfig loading rules
+func newKubeClient() (*kubernetes.Clientset, *rest.Config, error) {
+	config, err := newKubeConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return client, config, nil
+}
+
+// newDynamicClient builds a dynamic client for the Cosmonic and Gateway API custom resources
+func newDynamicClient() (dynamic.Interface, error) {
+	config, err := newKubeConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return dynamic.NewForConfig(config)
+}
+
+// hasResource reports whether the cluster serves the resource in the group version
+func hasResource(client kubernetes.Interface, groupVersion string, resource string) bool {
+	resources, err := client.Discovery().ServerResourcesForGroupVersion(groupVersion)
+	if err != nil {
+		return false
+	}
+	for _, r := range resources.APIResources {
+		if r.Name == resource {
+			return true
+		}
+	}
+	return false
+}
+
+// cosmonicResource finds the custom resource of the kind in the Cosmonic API groups, preferring the
+// version the server prefers. found is false when the CRD is not installed.
+func cosmonicResource(client kubernetes.Interface, kind string) (gvr schema.GroupVersionResource, found bool, err error) {
+	// a partial result is still usable when an unrelated aggregated API is unavailable
+	lists, err := client.Discovery().ServerPreferredResources()
+	if len(lists) == 0 && err != nil {
+		return gvr, false, err
+	}
+
+	for _, list := range lists {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil || !isCosmonicGroup(gv.Group) {
+			continue
+		}
+		for _, r := range list.APIResources {
+			if r.Kind == kind && !strings.Contains(r.Name, "/") {
+				return gv.WithResource(r.Name), true, nil
+			}
+		}
+	}
+	return gvr, false, nil
+}
+
+func isCosmonicGroup(group string) bool {
+	for _, suffix := range cosmonicAPIGroupSuffixes {
+		if group == suffix || strings.HasSuffix(group, "."+suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// workloadSelectors returns the pod selectors of every deployment, statefulset and daemonset
+// that belongs to the component, matching on the workload name or a "<component>-" prefix
+func workloadSelectors(ctx context.Context, client kubernetes.Interface, namespace string, component string) ([]labels.Selector, error) {
+	matches := func(name string) bool {
+		return name == component || strings.HasPrefix(name, component+"-")
+	}
+
+	var selectors []labels.Selector
+	add := func(selector *v1.LabelSelector) error {
+		s, err := v1.LabelSelectorAsSelector(selector)
+		if err != nil {
+			return err
+		}
+		selectors = append(selectors, s)
+		return nil
+	}
+
+	deployments, err := client.AppsV1().Deployments(namespace).List(ctx, v1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range deployments.Items {
+		if matches(d.Name) {
+			if err := add(d.Spec.Selector); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	statefulSets, err := client.AppsV1().StatefulSets(namespace).List(ctx, v1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range statefulSets.Items {
+		if matches(s.Name) {
+			if err := add(s.Spec.Selector); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	daemonSets, err := client.AppsV1().DaemonSets(namespace).List(ctx, v1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range daemonSets.Items {
+		if matches(d.Name) {
+			if err := add(d.Spec.Selector); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(selectors) == 0 {
+		return nil, fmt.Errorf("no workloads found for %s in namespace %s", component, namespace)
+	}
+
+	return selectors, nil
+}
+
+// releaseSelector selects the workloads that helm created for a release
+func releaseSelector(releaseName string) string {
+	return labels.Set{"app.kubernetes.io/instance": releaseName}.AsSelector().String()
+}
+
+// releaseReady reports whether the release has workloads and every deployment, statefulset and
+// daemonset of it has all its replicas ready
+func releaseReady(ctx context.Context, client kubernetes.Interface, namespace string, releaseName string) (bool, error) {
+	opts := v1.ListOptions{LabelSelector: releaseSelector(releaseName)}
+	workloads := 0
+
+	deployments, err := client.AppsV1().Deployments(namespace).List(ctx, opts)
+	if err != nil {
+		return false, err
+	}
+	for _, d := range deployments.Items {
+		workloads++
+		replicas := int32(1)
+		if d.Spec.Replicas != nil {
+			replicas = *d.Spec.Replicas
+		}
+		if d.Status.ObservedGeneration < d.Generation || d.Status.UpdatedReplicas < replicas || d.Status.ReadyReplicas < replicas {
+			return false, nil
+		}
+	}
+
+	statefulSets, err := client.AppsV1().StatefulSets(namespace).List(ctx, opts)
+	if err != nil {
+		return false, err
+	}
+	for _, s := range statefulSets.Items {
+		workloads++
+		replicas := int32(1)
+		if s.Spec.Replicas != nil {
+			replicas = *s.Spec.Replicas
+		}
+		if s.Status.ObservedGeneration < s.Generation || s.Status.ReadyReplicas < replicas {
+			return false, nil
+		}
+	}
+
+	daemonSets, err := client.AppsV1().DaemonSets(namespace).List(ctx, opts)
+	if err != nil {
+		return false, err
+	}
+	for _, d := range daemonSets.Items {
+		workloads++
+		desired := d.Status.DesiredNumberScheduled
+		if d.Status.ObservedGeneration < d.Generation || d.Status.UpdatedNumberScheduled < desired || d.Status.NumberReady < desired {
+			return false, nil
+		}
+	}
+
+	// right after an install helm may not have created anything yet
+	return workloads > 0, nil
+}
+
+// waitForRelease polls until the workloads of the release are ready or the timeout expires
+func waitForRelease(ctx context.Context, client kubernetes.Interface, namespace string, releaseName string, timeout time.Duration) error {
+	err := wait.PollUntilContextTimeout(ctx, 2*time.Second, timeout, true, func(ctx context.Context) (bool, error) {
+		return releaseReady(ctx, client, namespace, releaseName)
+	})
+	if err != nil {
+		return fmt.Errorf("%s did not become ready: %w", releaseName, err)
+	}
+	return nil
+}
+
+// waitForReleasePods polls until every pod of the release has terminated or the timeout expires
+func waitForReleasePods(ctx context.Context, client kubernetes.Interface, namespace string, releaseName string, timeout time.Duration, progress io.Writer) error {
+	lastCount := -1
+	err := wait.PollUntilContextTimeout(ctx, 2*time.Second, timeout, true, func(ctx context.Context) (bool, error) {
+		pods, err := client.CoreV1().Pods(namespace).List(ctx, v1.ListOptions{LabelSelector: releaseSelector(releaseName)})
+		if err != nil {
+			return false, err
+		}
+		if count := len(pods.Items); count > 0 && count != lastCount {
+			fmt.Fprintf(progress, "  waiting for %d %s pods to terminate\n", count, releaseName)
+			lastCount = count
+		}
+		return len(pods.Items) == 0, nil
+	})
+	if err != nil {
+		return fmt.Errorf("pods of %s did not terminate: %w", releaseName, err)
+	}
+	return nil
+}
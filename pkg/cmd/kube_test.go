@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestReleaseReady(t *testing.T) {
+	meta := func(name, release string) v1.ObjectMeta {
+		return v1.ObjectMeta{
+			Name:      name,
+			Namespace: cosmonicNamespace,
+			Labels:    map[string]string{"app.kubernetes.io/instance": release},
+		}
+	}
+	deployment := func(release string, replicas, ready int32) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: meta(release+"-deploy", release),
+			Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+			Status:     appsv1.DeploymentStatus{UpdatedReplicas: ready, ReadyReplicas: ready},
+		}
+	}
+	daemonSet := func(release string, desired, ready int32) *appsv1.DaemonSet {
+		return &appsv1.DaemonSet{
+			ObjectMeta: meta(release+"-ds", release),
+			Status:     appsv1.DaemonSetStatus{DesiredNumberScheduled: desired, UpdatedNumberScheduled: ready, NumberReady: ready},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		objects []runtime.Object
+		want    bool
+	}{
+		{name: "no workloads yet"},
+		{name: "only workloads of other releases", objects: []runtime.Object{deployment("other", 1, 1)}},
+		{name: "deployment ready", objects: []runtime.Object{deployment("nexus", 2, 2)}, want: true},
+		{name: "deployment not ready", objects: []runtime.Object{deployment("nexus", 2, 1)}},
+		{name: "daemonset ready", objects: []runtime.Object{daemonSet("nexus", 3, 3)}, want: true},
+		{name: "daemonset not ready", objects: []runtime.Object{deployment("nexus", 1, 1), daemonSet("nexus", 3, 2)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewClientset(tt.objects...)
+			got, err := releaseReady(context.Background(), client, cosmonicNamespace, "nexus")
+			if err != nil {
+				t.Fatalf("releaseReady() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("releaseReady() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,23 +1,337 @@
 package cmd
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cosmonic/kubectl-cosmo/pkg/internal/license"
 	"github.com/pkg/browser"
 	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/cli-runtime/pkg/genericiooptions"
 )
 
 const (
 	cosmonicLicenseURL = "https://cosmonic.com/trial"
+
+	// defaultLicenseWarnDays is how close to expiry a license has to be before commands warn about it
+	defaultLicenseWarnDays = 14
+	licenseWarnDaysEnv     = "COSMO_LICENSE_WARN_DAYS"
+	licenseCheckTimeout    = 3 * time.Second
+
+	// licenseCacheTTL is how long the license read for the expiry warning is reused, sparing every
+	// command the round-trip to the cluster
+	licenseCacheTTL  = time.Hour
+	licenseCacheDir  = "kubectl-cosmo"
+	licenseCacheFile = "license.json"
 )
 
+// licenseCacheEntry is the license of a cluster as last read, nil when none is installed
+type licenseCacheEntry struct {
+	License   *license.License `json:"license,omitempty"`
+	CheckedAt time.Time        `json:"checkedAt"`
+}
+
+// licenseCache maps the API server of a cluster to its license
+type licenseCache map[string]licenseCacheEntry
+
+type LicenseConfig struct {
+	configFlags *genericclioptions.ConfigFlags
+	keyFile     string
+	keyStdin    bool
+	output      string
+	genericiooptions.IOStreams
+}
+
 func NewCmdLicense(streams genericiooptions.IOStreams) *cobra.Command {
+	licenseCfg := &LicenseConfig{configFlags: genericclioptions.NewConfigFlags(true), IOStreams: streams}
+
 	cmd := &cobra.Command{
-		Use:   "license [flags]",
-		Short: "To obtain a license, visit cosmonic.com and sign up for a free trial key",
+		Use:         "license [command] [flags]",
+		Annotations: map[string]string{skipLicenseCheck: "true"},
+		Short:       "To obtain a license, visit cosmonic.com and sign up for a free trial key",
 		RunE: func(c *cobra.Command, args []string) error {
 			return browser.OpenURL(cosmonicLicenseURL)
 		},
 	}
 
+	// apply command
+	var applyCmd = &cobra.Command{
+		Use:   "apply --key-file <file> | --key-stdin",
+		Short: "stores the license key in the cluster for Cosmonic Control",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			key, err := licenseCfg.readKey()
+			if err != nil {
+				return err
+			}
+
+			return licenseCfg.Apply(context.Background(), key)
+		},
+	}
+	applyCmd.Flags().StringVar(&licenseCfg.keyFile, "key-file", "", "file containing the license key")
+	applyCmd.Flags().BoolVar(&licenseCfg.keyStdin, "key-stdin", false, "read the license key from stdin")
+	applyCmd.MarkFlagsOneRequired("key-file", "key-stdin")
+	applyCmd.MarkFlagsMutuallyExclusive("key-file", "key-stdin")
+
+	// status command
+	var statusCmd = &cobra.Command{
+		Use:   "status",
+		Short: "shows the licensee, entitlements and expiry of the installed license",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateOutputFormat(licenseCfg.output); err != nil {
+				return err
+			}
+			return licenseCfg.Status(context.Background())
+		},
+	}
+	statusCmd.Flags().StringVarP(&licenseCfg.output, "output", "o", "", "output format, one of json or yaml")
+
+	// remove command
+	var removeCmd = &cobra.Command{
+		Use:   "remove",
+		Short: "removes the license key from the cluster",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return licenseCfg.Remove(context.Background())
+		},
+	}
+
+	// add subcommands
+	cmd.AddCommand(applyCmd)
+	cmd.AddCommand(statusCmd)
+	cmd.AddCommand(removeCmd)
+
 	return cmd
 }
+
+// readKey reads the license key from --key-file or stdin
+func (l *LicenseConfig) readKey() (string, error) {
+	var data []byte
+	var err error
+	if l.keyStdin {
+		data, err = io.ReadAll(l.In)
+	} else {
+		data, err = os.ReadFile(l.keyFile)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	key := strings.TrimSpace(string(data))
+	if key == "" {
+		return "", errors.New("license key is empty")
+	}
+	return key, nil
+}
+
+// Apply stores the license key in the install namespace
+func (l *LicenseConfig) Apply(ctx context.Context, key string) error {
+	client, _, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+
+	lic, err := license.Apply(ctx, client, cosmonicNamespace, key)
+	if err != nil {
+		return err
+	}
+	forgetCachedLicense()
+
+	fmt.Fprintf(l.Out, "license for %s applied, expires %s\n", lic.Licensee, lic.ExpiresAt.Format(time.DateOnly))
+	return nil
+}
+
+// Status displays the decoded license installed in the cluster
+func (l *LicenseConfig) Status(ctx context.Context) error {
+	client, _, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+
+	lic, err := license.Load(ctx, client, cosmonicNamespace)
+	if err != nil {
+		return err
+	}
+
+	if len(l.output) > 0 {
+		return printStructured(l.Out, l.output, struct {
+			*license.License
+			Expired       bool `json:"expired"`
+			DaysRemaining int  `json:"daysRemaining"`
+		}{lic, lic.Expired(), lic.DaysRemaining()})
+	}
+
+	state := fmt.Sprintf("valid, %d days remaining", lic.DaysRemaining())
+	if lic.Expired() {
+		state = "expired"
+	}
+
+	w := tabwriter.NewWriter(l.Out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Licensee:\t%s\n", lic.Licensee)
+	fmt.Fprintf(w, "Entitlements:\t%s\n", strings.Join(lic.Entitlements, ", "))
+	if !lic.IssuedAt.IsZero() {
+		fmt.Fprintf(w, "Issued:\t%s\n", lic.IssuedAt.Format(time.DateOnly))
+	}
+	fmt.Fprintf(w, "Expires:\t%s\n", lic.ExpiresAt.Format(time.DateOnly))
+	fmt.Fprintf(w, "Status:\t%s\n", state)
+	return w.Flush()
+}
+
+// Remove deletes the license key from the cluster
+func (l *LicenseConfig) Remove(ctx context.Context) error {
+	client, _, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+
+	if err := license.Remove(ctx, client, cosmonicNamespace); err != nil {
+		return err
+	}
+	forgetCachedLicense()
+
+	fmt.Fprintln(l.Out, "license removed")
+	return nil
+}
+
+// sameLicense reports whether two licenses are for the same licensee and expire at the same time
+func sameLicense(current *license.License, desired *license.License) bool {
+	return current.Licensee == desired.Licensee && current.ExpiresAt.Equal(desired.ExpiresAt)
+}
+
+// installedLicense loads the license installed in the current cluster
+func installedLicense(ctx context.Context) (*license.License, error) {
+	client, _, err := newKubeClient()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, licenseCheckTimeout)
+	defer cancel()
+
+	return license.Load(ctx, client, cosmonicNamespace)
+}
+
+// licenseWarnDays resolves how many days before expiry to warn, from the flag or the environment
+func licenseWarnDays(cmd *cobra.Command) int {
+	if flag := cmd.Flags().Lookup("license-warn-days"); flag != nil && flag.Changed {
+		days, _ := cmd.Flags().GetInt("license-warn-days")
+		return days
+	}
+	if env := os.Getenv(licenseWarnDaysEnv); env != "" {
+		if days, err := strconv.Atoi(env); err == nil {
+			return days
+		}
+	}
+	return defaultLicenseWarnDays
+}
+
+// warnLicenseExpiry prints a warning when the installed license is expired or close to it. Any
+// failure to read the license is ignored, this must never get in the way of the command itself.
+func warnLicenseExpiry(cmd *cobra.Command, errOut io.Writer) {
+	days := licenseWarnDays(cmd)
+	if days < 0 {
+		return
+	}
+
+	lic, err := cachedLicense(cmd.Context())
+	if err != nil {
+		return
+	}
+
+	if lic.Expired() {
+		fmt.Fprintf(errOut, "Warning: the Cosmonic license for %s expired on %s, visit %s to renew it\n", lic.Licensee, lic.ExpiresAt.Format(time.DateOnly), cosmonicLicenseURL)
+		return
+	}
+	if remaining := lic.DaysRemaining(); remaining <= days {
+		fmt.Fprintf(errOut, "Warning: the Cosmonic license for %s expires in %d days on %s\n", lic.Licensee, remaining, lic.ExpiresAt.Format(time.DateOnly))
+	}
+}
+
+// cachedLicense is installedLicense read from the cluster at most once per licenseCacheTTL
+func cachedLicense(ctx context.Context) (*license.License, error) {
+	config, err := newKubeConfig()
+	if err != nil {
+		return nil, err
+	}
+	path, err := licenseCachePath()
+	if err != nil {
+		return installedLicense(ctx)
+	}
+
+	cache := loadLicenseCache(path)
+	if entry, ok := cache.lookup(config.Host, time.Now()); ok {
+		if entry.License == nil {
+			return nil, license.ErrNotInstalled
+		}
+		return entry.License, nil
+	}
+
+	lic, err := installedLicense(ctx)
+	if err != nil && !errors.Is(err, license.ErrNotInstalled) {
+		return nil, err
+	}
+	cache[config.Host] = licenseCacheEntry{License: lic, CheckedAt: time.Now()}
+	// a cache that cannot be written only costs the next command a round-trip
+	_ = cache.save(path)
+	return lic, err
+}
+
+// forgetCachedLicense drops the cached licenses once a command changes the license of a cluster
+func forgetCachedLicense() {
+	if path, err := licenseCachePath(); err == nil {
+		os.Remove(path)
+	}
+}
+
+func licenseCachePath() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, licenseCacheDir, licenseCacheFile), nil
+}
+
+// loadLicenseCache reads the cached licenses, a missing or unreadable cache is taken as empty
+func loadLicenseCache(path string) licenseCache {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return licenseCache{}
+	}
+
+	cache := licenseCache{}
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return licenseCache{}
+	}
+	return cache
+}
+
+func (cache licenseCache) save(path string) error {
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+// lookup returns the entry of the cluster when it was read within licenseCacheTTL of now
+func (cache licenseCache) lookup(server string, now time.Time) (licenseCacheEntry, bool) {
+	entry, ok := cache[server]
+	if !ok || now.Before(entry.CheckedAt) || now.Sub(entry.CheckedAt) > licenseCacheTTL {
+		return licenseCacheEntry{}, false
+	}
+	return entry, true
+}
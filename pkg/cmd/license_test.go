@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cosmonic/kubectl-cosmo/pkg/internal/license"
+)
+
+func TestLicenseCacheLookup(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	lic := &license.License{Licensee: "acme", ExpiresAt: now.AddDate(0, 0, 10)}
+	cache := licenseCache{
+		"https://fresh:6443":      {License: lic, CheckedAt: now.Add(-10 * time.Minute)},
+		"https://stale:6443":      {License: lic, CheckedAt: now.Add(-2 * time.Hour)},
+		"https://unlicensed:6443": {CheckedAt: now.Add(-time.Minute)},
+		"https://future:6443":     {License: lic, CheckedAt: now.Add(time.Hour)},
+	}
+
+	tests := []struct {
+		server      string
+		wantOK      bool
+		wantLicense bool
+	}{
+		{server: "https://fresh:6443", wantOK: true, wantLicense: true},
+		{server: "https://stale:6443"},
+		{server: "https://unlicensed:6443", wantOK: true},
+		{server: "https://future:6443"},
+		{server: "https://unknown:6443"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.server, func(t *testing.T) {
+			entry, ok := cache.lookup(tt.server, now)
+			if ok != tt.wantOK || (entry.License != nil) != tt.wantLicense {
+				t.Errorf("lookup(%s) = %+v, %v, want license %v, ok %v", tt.server, entry, ok, tt.wantLicense, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestLicenseCacheSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), licenseCacheDir, licenseCacheFile)
+	if got := loadLicenseCache(path); len(got) != 0 {
+		t.Fatalf("loadLicenseCache() of a missing file = %v, want empty", got)
+	}
+
+	checkedAt := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	expiresAt := checkedAt.AddDate(1, 0, 0)
+	cache := licenseCache{"https://cluster:6443": {License: &license.License{Licensee: "acme", ExpiresAt: expiresAt}, CheckedAt: checkedAt}}
+	if err := cache.save(path); err != nil {
+		t.Fatalf("save() error = %v", err)
+	}
+
+	entry := loadLicenseCache(path)["https://cluster:6443"]
+	if entry.License == nil || entry.License.Licensee != "acme" || !entry.License.ExpiresAt.Equal(expiresAt) || !entry.CheckedAt.Equal(checkedAt) {
+		t.Errorf("loadLicenseCache() = %+v, want the saved entry", entry)
+	}
+}
@@ -0,0 +1,332 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+	"k8s.io/client-go/kubernetes"
+)
+
+// prefixColors are the ANSI colors cycled through for the pod/container prefix
+var prefixColors = []int{31, 32, 33, 34, 35, 36, 91, 92, 93, 94, 95, 96}
+
+type LogsConfig struct {
+	configFlags *genericclioptions.ConfigFlags
+	component   string
+	follow      bool
+	since       time.Duration
+	grep        string
+	grepRegex   *regexp.Regexp
+	color       bool
+	genericiooptions.IOStreams
+
+	client    kubernetes.Interface
+	outMutex  sync.Mutex
+	streamsMu sync.Mutex
+	// streaming maps the pod/container keys being streamed to the id of the container instance
+	streaming map[string]string
+	wg        sync.WaitGroup
+}
+
+func NewCmdLogs(streams genericiooptions.IOStreams) *cobra.Command {
+	logsCfg := &LogsConfig{configFlags: genericclioptions.NewConfigFlags(true), IOStreams: streams}
+
+	cmd := &cobra.Command{
+		Use:       "logs [nexus|hostgroup|console] [flags]",
+		Short:     "Stream the logs of every pod of a Cosmonic component",
+		Args:      cobra.ExactArgs(1),
+		ValidArgs: componentNames,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := logsCfg.Complete(cmd, args); err != nil {
+				return err
+			}
+			if err := logsCfg.Validate(); err != nil {
+				return err
+			}
+
+			return logsCfg.Run()
+		},
+	}
+
+	cmd.Flags().BoolVarP(&logsCfg.follow, "follow", "f", false, "follow the logs and pick up pods as they are created")
+	cmd.Flags().DurationVar(&logsCfg.since, "since", 0, "only return logs newer than a relative duration like 5s, 2m, or 3h")
+	cmd.Flags().StringVar(&logsCfg.grep, "grep", "", "only print lines matching the regular expression")
+
+	return cmd
+}
+
+// Complete sets the component and compiles the grep filter
+func (l *LogsConfig) Complete(cmd *cobra.Command, args []string) error {
+	l.component = args[0]
+	l.streaming = map[string]string{}
+
+	if len(l.grep) > 0 {
+		re, err := regexp.Compile(l.grep)
+		if err != nil {
+			return fmt.Errorf("invalid --grep expression: %w", err)
+		}
+		l.grepRegex = re
+	}
+
+	if f, ok := l.Out.(*os.File); ok {
+		l.color = term.IsTerminal(int(f.Fd()))
+	}
+
+	return nil
+}
+
+// Validate checks that the component is known
+func (l *LogsConfig) Validate() error {
+	for _, name := range componentNames {
+		if name == l.component {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown component %q, must be one of %s", l.component, strings.Join(componentNames, ", "))
+}
+
+// Run streams the logs of all the component pods until they end, or until interrupted when following
+func (l *LogsConfig) Run() error {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	client, _, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+	l.client = client
+
+	selectors, err := workloadSelectors(ctx, client, cosmonicNamespace, l.component)
+	if err != nil {
+		return err
+	}
+
+	var watchers sync.WaitGroup
+	for _, selector := range selectors {
+		podList, err := client.CoreV1().Pods(cosmonicNamespace).List(ctx, v1.ListOptions{LabelSelector: selector.String()})
+		if err != nil {
+			return err
+		}
+		for i := range podList.Items {
+			l.streamPod(ctx, &podList.Items[i])
+		}
+
+		if l.follow {
+			watchers.Add(1)
+			go func(selector labels.Selector, resourceVersion string) {
+				defer watchers.Done()
+				l.watchPods(ctx, selector, resourceVersion)
+			}(selector, podList.ResourceVersion)
+		}
+	}
+
+	// watchers only return once interrupted, so no new streams are started after this
+	watchers.Wait()
+	l.wg.Wait()
+
+	return nil
+}
+
+// watchPods starts streaming containers of pods that are created or restarted after the initial
+// listing. When the watch fails the pods are listed again, with backoff, so none are missed.
+func (l *LogsConfig) watchPods(ctx context.Context, selector labels.Selector, resourceVersion string) {
+	backoff := reconnectBackoff()
+	retry := func(err error) bool {
+		if ctx.Err() != nil {
+			return false
+		}
+		fmt.Fprintf(l.ErrOut, "error watching pods: %v, retrying\n", err)
+		return sleepOrDone(ctx, nil, backoff.Step())
+	}
+
+	for ctx.Err() == nil {
+		if resourceVersion == "" {
+			podList, err := l.client.CoreV1().Pods(cosmonicNamespace).List(ctx, v1.ListOptions{LabelSelector: selector.String()})
+			if err != nil {
+				if !retry(err) {
+					return
+				}
+				continue
+			}
+			for i := range podList.Items {
+				l.streamPod(ctx, &podList.Items[i])
+			}
+			resourceVersion = podList.ResourceVersion
+		}
+
+		watcher, err := l.client.CoreV1().Pods(cosmonicNamespace).Watch(ctx, v1.ListOptions{
+			LabelSelector:   selector.String(),
+			ResourceVersion: resourceVersion,
+		})
+		if err != nil {
+			resourceVersion = ""
+			if !retry(err) {
+				return
+			}
+			continue
+		}
+
+		for event := range watcher.ResultChan() {
+			if event.Type == watch.Error {
+				// the resource version has most likely expired, list again from the current state
+				resourceVersion = ""
+				break
+			}
+			pod, ok := event.Object.(*corev1.Pod)
+			if !ok {
+				continue
+			}
+			backoff = reconnectBackoff()
+			resourceVersion = pod.ResourceVersion
+			if event.Type == watch.Added || event.Type == watch.Modified {
+				l.streamPod(ctx, pod)
+			}
+		}
+		watcher.Stop()
+	}
+}
+
+// streamPod starts a log stream for every container of the pod that is not already streaming
+func (l *LogsConfig) streamPod(ctx context.Context, pod *corev1.Pod) {
+	if pod.Status.Phase == corev1.PodPending || pod.Status.Phase == corev1.PodUnknown {
+		return
+	}
+
+	for _, container := range pod.Spec.Containers {
+		containerID, running := containerInstance(pod, container.Name)
+		// when following, only attach to containers that are running so a restart picks up the new instance
+		if l.follow && !running {
+			continue
+		}
+		l.streamContainerInstance(ctx, pod.Name, container.Name, containerID)
+	}
+}
+
+// containerInstance returns the id of the current instance of the container and whether it is running
+func containerInstance(pod *corev1.Pod, containerName string) (string, bool) {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == containerName {
+			return status.ContainerID, status.State.Running != nil
+		}
+	}
+	return "", false
+}
+
+// streamContainerInstance starts a log stream for the container unless its instance is already
+// streaming. A restarted container has a new id, so it is attached while the stream of its previous
+// instance winds down.
+func (l *LogsConfig) streamContainerInstance(ctx context.Context, podName string, containerName string, containerID string) {
+	key := fmt.Sprintf("%s/%s", podName, containerName)
+	l.streamsMu.Lock()
+	if streamed, ok := l.streaming[key]; ok && streamed == containerID {
+		l.streamsMu.Unlock()
+		return
+	}
+	l.streaming[key] = containerID
+	l.streamsMu.Unlock()
+
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+
+		if err := l.streamContainer(ctx, podName, containerName); err != nil && ctx.Err() == nil {
+			fmt.Fprintf(l.ErrOut, "error streaming logs for %s: %v\n", key, err)
+		}
+
+		// the container may have restarted without the watch attaching to the new instance yet
+		var pod *corev1.Pod
+		if l.follow && ctx.Err() == nil {
+			if current, err := l.client.CoreV1().Pods(cosmonicNamespace).Get(ctx, podName, v1.GetOptions{}); err == nil {
+				pod = current
+			}
+		}
+
+		l.streamsMu.Lock()
+		if l.streaming[key] == containerID {
+			delete(l.streaming, key)
+		}
+		l.streamsMu.Unlock()
+
+		if pod == nil {
+			return
+		}
+		if newID, running := containerInstance(pod, containerName); running && newID != containerID {
+			l.streamContainerInstance(ctx, podName, containerName, newID)
+		}
+	}()
+}
+
+func (l *LogsConfig) streamContainer(ctx context.Context, podName string, containerName string) error {
+	opts := &corev1.PodLogOptions{
+		Container: containerName,
+		Follow:    l.follow,
+	}
+	if l.since > 0 {
+		sinceSeconds := int64(l.since.Seconds())
+		opts.SinceSeconds = &sinceSeconds
+	}
+
+	stream, err := l.client.CoreV1().Pods(cosmonicNamespace).GetLogs(podName, opts).Stream(ctx)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	prefix := l.prefix(podName, containerName)
+	reader := bufio.NewReader(stream)
+	for {
+		line, err := reader.ReadString('\n')
+		if len(line) > 0 {
+			l.writeLine(prefix, line)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (l *LogsConfig) writeLine(prefix string, line string) {
+	if l.grepRegex != nil && !l.grepRegex.MatchString(line) {
+		return
+	}
+	if !strings.HasSuffix(line, "\n") {
+		line += "\n"
+	}
+
+	l.outMutex.Lock()
+	defer l.outMutex.Unlock()
+	fmt.Fprintf(l.Out, "%s %s", prefix, line)
+}
+
+// prefix returns the [pod/container] prefix, colored consistently for the same pod and container
+func (l *LogsConfig) prefix(podName string, containerName string) string {
+	prefix := fmt.Sprintf("[%s/%s]", podName, containerName)
+	if !l.color {
+		return prefix
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(prefix))
+	color := prefixColors[hash.Sum32()%uint32(len(prefixColors))]
+	return fmt.Sprintf("\x1b[%dm%s\x1b[0m", color, prefix)
+}
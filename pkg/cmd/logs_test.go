@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestStreamRestartedContainer(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: v1.ObjectMeta{Name: "nexus-0", Namespace: cosmonicNamespace},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "nexus"}}},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name:         "nexus",
+				ContainerID:  "containerd://second",
+				RestartCount: 1,
+				State:        corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+			}},
+		},
+	}
+
+	out := &bytes.Buffer{}
+	streams := genericiooptions.IOStreams{Out: out, ErrOut: &bytes.Buffer{}}
+	l := &LogsConfig{IOStreams: streams, follow: true, client: fake.NewClientset(pod), streaming: map[string]string{}}
+
+	// the first instance ended, the stream must move on to the restarted one and stop there
+	l.streamContainerInstance(context.Background(), "nexus-0", "nexus", "containerd://first")
+	l.wg.Wait()
+
+	if got := strings.Count(out.String(), "[nexus-0/nexus]"); got != 2 {
+		t.Errorf("streamed %d instances, want 2:\n%s", got, out.String())
+	}
+	if len(l.streaming) != 0 {
+		t.Errorf("streams left behind: %v", l.streaming)
+	}
+}
+
+func TestStreamPodSkipsStreamingInstance(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: v1.ObjectMeta{Name: "nexus-0", Namespace: cosmonicNamespace},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "nexus"}}},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name:        "nexus",
+				ContainerID: "containerd://first",
+				State:       corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+			}},
+		},
+	}
+
+	out := &bytes.Buffer{}
+	streams := genericiooptions.IOStreams{Out: out, ErrOut: &bytes.Buffer{}}
+	l := &LogsConfig{IOStreams: streams, follow: true, client: fake.NewClientset(pod), streaming: map[string]string{"nexus-0/nexus": "containerd://first"}}
+
+	l.streamPod(context.Background(), pod)
+	l.wg.Wait()
+
+	if out.Len() != 0 {
+		t.Errorf("streamed an instance already streaming:\n%s", out.String())
+	}
+}
@@ -2,10 +2,14 @@ package cmd
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"os"
+	"time"
 
 	chartManager "github.com/cosmonic/kubectl-cosmo/pkg/internal/chartmanager"
+	"github.com/cosmonic/kubectl-cosmo/pkg/internal/license"
 	"github.com/spf13/cobra"
 	"helm.sh/helm/v3/pkg/cli"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
@@ -20,6 +24,8 @@ type NexusConfig struct {
 	manager        *chartManager.ChartManager
 	configFlags    *genericclioptions.ConfigFlags
 	forceUninstall *bool
+	releaseFlags   releaseFlags
+	licenseFile    string
 	genericiooptions.IOStreams
 
 	settings *cli.EnvSettings
@@ -56,9 +62,28 @@ func NewCmdNexus(streams genericiooptions.IOStreams) *cobra.Command {
 				return err
 			}
 
-			return nexus.manager.Install(context.TODO(), controlChartName)
+			opts, err := nexus.releaseFlags.options()
+			if err != nil {
+				return err
+			}
+
+			// only license a cluster the install is going to proceed on
+			if len(nexus.licenseFile) > 0 {
+				if _, err := nexus.manager.GetRelease(controlChartName); err == nil {
+					return errors.New("chart is already installed, apply the license with kubectl cosmo license apply")
+				} else if !errors.Is(err, chartManager.ErrReleaseNotFound) {
+					return err
+				}
+				if err := nexus.applyLicense(context.TODO()); err != nil {
+					return err
+				}
+			}
+
+			return nexus.manager.InstallRelease(context.TODO(), controlChartName, controlChartName, opts)
 		},
 	}
+	nexus.releaseFlags.addFlags(installCmd.Flags())
+	installCmd.Flags().StringVar(&nexus.licenseFile, "license-file", "", "file containing a license key to apply before installing")
 
 	// update command
 	var updateCmd = &cobra.Command{
@@ -69,9 +94,15 @@ func NewCmdNexus(streams genericiooptions.IOStreams) *cobra.Command {
 				return err
 			}
 
-			return nexus.manager.Update(controlChartName)
+			opts, err := nexus.releaseFlags.options()
+			if err != nil {
+				return err
+			}
+
+			return nexus.manager.Update(controlChartName, controlChartName, opts)
 		},
 	}
+	nexus.releaseFlags.addFlags(updateCmd.Flags())
 
 	// uninstall command
 	var uninstallCmd = &cobra.Command{
@@ -88,10 +119,20 @@ func NewCmdNexus(streams genericiooptions.IOStreams) *cobra.Command {
 	nexus.forceUninstall = uninstallCmd.Flags().Bool("force", false, "must specify force to uninstall the nexus control plane")
 	uninstallCmd.MarkFlagRequired("force")
 
+	// export command
+	exportCmd := newCmdExport(streams, "nexus", controlChartName, controlChartName, func(cmd *cobra.Command, args []string) (*chartManager.ChartManager, error) {
+		if err := nexus.Initialize(cmd, args); err != nil {
+			return nil, err
+		}
+		return nexus.manager, nil
+	})
+
 	// add subcommands
 	cmd.AddCommand(installCmd)
 	cmd.AddCommand(updateCmd)
 	cmd.AddCommand(uninstallCmd)
+	cmd.AddCommand(exportCmd)
+	cmd.AddCommand(newCmdJoinToken(streams))
 
 	return cmd
 }
@@ -132,3 +173,25 @@ func (nexus *NexusConfig) Run() error {
 
 	return nil
 }
+
+// applyLicense stores the key from --license-file so Cosmonic Control starts licensed
+func (nexus *NexusConfig) applyLicense(ctx context.Context) error {
+	key, err := os.ReadFile(nexus.licenseFile)
+	if err != nil {
+		return err
+	}
+
+	client, _, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+
+	lic, err := license.Apply(ctx, client, cosmonicNamespace, string(key))
+	if err != nil {
+		return fmt.Errorf("failed to apply license: %w", err)
+	}
+	forgetCachedLicense()
+
+	nexus.logger.Printf("license for %s applied, expires %s\n", lic.Licensee, lic.ExpiresAt.Format(time.DateOnly))
+	return nil
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	outputJSON = "json"
+	outputYAML = "yaml"
+	outputWide = "wide"
+)
+
+// validateOutputFormat checks an -o value for commands that support the structured formats
+func validateOutputFormat(output string, extra ...string) error {
+	switch output {
+	case "", outputJSON, outputYAML:
+		return nil
+	}
+	for _, format := range extra {
+		if output == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported output format %q", output)
+}
+
+// printStructured writes v as json or yaml
+func printStructured(out io.Writer, output string, v interface{}) error {
+	switch output {
+	case outputJSON:
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(out, string(data))
+		return err
+	case outputYAML:
+		data, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = out.Write(data)
+		return err
+	default:
+		return fmt.Errorf("unsupported output format %q", output)
+	}
+}
@@ -0,0 +1,565 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// portForwardTarget is a built-in port-forward target, resolved to the first Service that serves it
+type portForwardTarget struct {
+	description string
+	// services are the Service names to look for, matched exactly or as the "-<name>" suffix of a release
+	services []string
+	// ports are the Service port names to forward, every port of the Service when empty
+	ports []string
+}
+
+// portForwardTargets are the built-in targets of port-forward, any other name is taken as a Service name
+var portForwardTargets = map[string]portForwardTarget{
+	"nexus":   {description: "the nexus API", services: []string{"nexus", controlChartName}, ports: []string{"api", "http", "https", "grpc"}},
+	"nats":    {description: "the NATS client endpoint", services: []string{"nats"}, ports: []string{"client", "nats"}},
+	"metrics": {description: "the Prometheus metrics endpoint", services: []string{"nexus", controlChartName, "metrics"}, ports: []string{"metrics", "http-metrics", "prometheus"}},
+	"console": {description: "the console UI", services: []string{consoleService}},
+}
+
+// forwardPort is a local port and the pod port it is forwarded to, a named remote port is looked
+// up in the containers of the pod. A local port of 0 is assigned by the kernel.
+type forwardPort struct {
+	local  int
+	remote intstr.IntOrString
+}
+
+// serviceForward is a target resolved to the pods behind a Service and the ports to forward
+type serviceForward struct {
+	service  string
+	selector labels.Selector
+	ports    []forwardPort
+}
+
+type PortForwardConfig struct {
+	configFlags *genericclioptions.ConfigFlags
+	target      string
+	portSpecs   []string
+	address     string
+	genericiooptions.IOStreams
+}
+
+func NewCmdPortForward(streams genericiooptions.IOStreams) *cobra.Command {
+	pf := &PortForwardConfig{configFlags: genericclioptions.NewConfigFlags(true), IOStreams: streams}
+
+	var targets []string
+	for name, target := range portForwardTargets {
+		targets = append(targets, fmt.Sprintf("  %-8s %s", name, target.description))
+	}
+	sort.Strings(targets)
+
+	var validArgs []string
+	for name := range portForwardTargets {
+		validArgs = append(validArgs, name)
+	}
+	sort.Strings(validArgs)
+
+	cmd := &cobra.Command{
+		Use:   "port-forward <component> [[local:]remote...] [flags]",
+		Short: "Forward local ports to a Cosmonic service",
+		Long: fmt.Sprintf(`Forward local ports to the pods behind a Cosmonic service, reconnecting when a pod goes away.
+
+The component is one of the built-in targets below, or the name of any Service in the %s
+namespace. Without ports, the ports of the target are forwarded to the same local ports. A remote
+port is a Service port number or name, and a local port of 0 picks a free port.
+
+Built-in targets:
+%s`, cosmonicNamespace, strings.Join(targets, "\n")),
+		Example: `  # NATS for wash, on localhost:4222
+  kubectl cosmo port-forward nats
+
+  # the nexus API on a different local port
+  kubectl cosmo port-forward nexus 9000:api
+
+  # scrape the metrics endpoint from a local Prometheus
+  kubectl cosmo port-forward metrics 0:metrics --address 0.0.0.0`,
+		Args:      cobra.MinimumNArgs(1),
+		ValidArgs: validArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := pf.Complete(cmd, args); err != nil {
+				return err
+			}
+			if err := pf.Validate(); err != nil {
+				return err
+			}
+
+			return pf.Run()
+		},
+	}
+
+	cmd.Flags().StringVar(&pf.address, "address", "localhost", "local address to bind the port-forward to")
+
+	return cmd
+}
+
+// Complete sets the target and port specs
+func (pf *PortForwardConfig) Complete(cmd *cobra.Command, args []string) error {
+	pf.target = args[0]
+	pf.portSpecs = args[1:]
+	return nil
+}
+
+// Validate checks the syntax of the port specs
+func (pf *PortForwardConfig) Validate() error {
+	for _, spec := range pf.portSpecs {
+		if _, _, err := parsePortSpec(spec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run forwards the ports until interrupted
+func (pf *PortForwardConfig) Run() error {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	client, config, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+
+	target, err := resolvePortForward(ctx, client, pf.target, pf.portSpecs)
+	if err != nil {
+		return err
+	}
+
+	forwarder := &podForwarder{
+		client:    client,
+		config:    config,
+		namespace: cosmonicNamespace,
+		selector:  target.selector,
+		name:      target.service,
+		address:   pf.address,
+		ports:     target.ports,
+		out:       pf.Out,
+		status:    pf.ErrOut,
+	}
+
+	readyCh := make(chan struct{})
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- forwarder.Run(ctx, readyCh, nil)
+	}()
+
+	select {
+	case <-readyCh:
+		fmt.Fprintln(pf.ErrOut, "Ctrl+C when finished")
+	case err := <-errChan:
+		return err
+	}
+	return <-errChan
+}
+
+// resolvePortForward finds the Service of the target and maps the port specs to its ports
+func resolvePortForward(ctx context.Context, client kubernetes.Interface, name string, specs []string) (*serviceForward, error) {
+	services, err := client.CoreV1().Services(cosmonicNamespace).List(ctx, v1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(services.Items, func(i, j int) bool { return services.Items[i].Name < services.Items[j].Name })
+
+	target, builtin := portForwardTargets[name]
+	if !builtin {
+		target = portForwardTarget{services: []string{name}}
+	}
+
+	svc, ports := findTargetService(services.Items, target, builtin)
+	if svc == nil {
+		if builtin {
+			return nil, fmt.Errorf("no service found for %s in namespace %s, tried %s", name, cosmonicNamespace, strings.Join(triedServices(target), "; "))
+		}
+		return nil, fmt.Errorf("unknown component %q, must be a service in namespace %s or one of nexus, nats, metrics, console", name, cosmonicNamespace)
+	}
+	if len(svc.Spec.Selector) == 0 {
+		return nil, fmt.Errorf("service %s has no pod selector to forward to", svc.Name)
+	}
+
+	forward := &serviceForward{service: svc.Name, selector: labels.SelectorFromSet(svc.Spec.Selector)}
+
+	if len(specs) == 0 {
+		for _, port := range ports {
+			forward.ports = append(forward.ports, forwardPort{local: int(port.Port), remote: servicePortTarget(port)})
+		}
+		return forward, nil
+	}
+
+	for _, spec := range specs {
+		local, remote, err := parsePortSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+
+		found := false
+		for _, port := range svc.Spec.Ports {
+			if port.Name == remote || strconv.Itoa(int(port.Port)) == remote {
+				if local < 0 {
+					local = int(port.Port)
+				}
+				forward.ports = append(forward.ports, forwardPort{local: local, remote: servicePortTarget(port)})
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+
+		// a port the service does not expose is forwarded to the pod as is
+		number, err := strconv.Atoi(remote)
+		if err != nil {
+			return nil, fmt.Errorf("service %s has no port named %s", svc.Name, remote)
+		}
+		if local < 0 {
+			local = number
+		}
+		forward.ports = append(forward.ports, forwardPort{local: local, remote: intstr.FromInt(number)})
+	}
+
+	return forward, nil
+}
+
+// findTargetService returns the first Service matching the target and its ports to forward. Only the
+// Services named by the target are considered, so an unrelated Service exposing a port of the same
+// name is never picked.
+func findTargetService(services []corev1.Service, target portForwardTarget, builtin bool) (*corev1.Service, []corev1.ServicePort) {
+	matchPorts := func(svc *corev1.Service) []corev1.ServicePort {
+		if len(target.ports) == 0 {
+			return svc.Spec.Ports
+		}
+		for _, name := range target.ports {
+			for _, port := range svc.Spec.Ports {
+				if port.Name == name {
+					return []corev1.ServicePort{port}
+				}
+			}
+		}
+		return nil
+	}
+
+	for _, name := range target.services {
+		for i := range services {
+			svc := &services[i]
+			if svc.Name != name && !(builtin && strings.HasSuffix(svc.Name, "-"+name)) {
+				continue
+			}
+			if ports := matchPorts(svc); len(ports) > 0 {
+				return svc, ports
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// triedServices describes the Services findTargetService looks for when resolving a built-in target
+func triedServices(target portForwardTarget) []string {
+	var tried []string
+	for _, name := range target.services {
+		service := fmt.Sprintf("%s or *-%s", name, name)
+		if len(target.ports) > 0 {
+			service += fmt.Sprintf(" with one of the ports %s", strings.Join(target.ports, ", "))
+		}
+		tried = append(tried, service)
+	}
+	return tried
+}
+
+// servicePortTarget is the pod port a Service port sends traffic to
+func servicePortTarget(port corev1.ServicePort) intstr.IntOrString {
+	if port.TargetPort.Type == intstr.String && port.TargetPort.StrVal != "" {
+		return port.TargetPort
+	}
+	if port.TargetPort.IntVal > 0 {
+		return port.TargetPort
+	}
+	return intstr.FromInt(int(port.Port))
+}
+
+// parsePortSpec splits [local:]remote, local is -1 when not given so the remote port number is used
+func parsePortSpec(spec string) (int, string, error) {
+	local, remote, found := strings.Cut(spec, ":")
+	if !found {
+		return -1, spec, nil
+	}
+	if remote == "" {
+		return 0, "", fmt.Errorf("invalid port %q, the remote port is missing", spec)
+	}
+	if local == "" {
+		return 0, remote, nil
+	}
+
+	port, err := strconv.Atoi(local)
+	if err != nil || port < 0 || port > 65535 {
+		return 0, "", fmt.Errorf("invalid local port in %q", spec)
+	}
+	return port, remote, nil
+}
+
+// podForwarder forwards local ports to a ready pod of the selector, reconnecting to another ready
+// pod whenever the current one goes away
+type podForwarder struct {
+	client    kubernetes.Interface
+	config    *rest.Config
+	namespace string
+	selector  labels.Selector
+	// name describes the pods in status messages
+	name    string
+	address string
+	ports   []forwardPort
+	// out receives the forwarding addresses, status the connection changes
+	out    io.Writer
+	status io.Writer
+}
+
+// Run forwards the ports until ctx is cancelled or stopCh is signalled, when it returns nil. readyCh
+// is closed the first time the tunnel is up. Kernel assigned local ports are kept across reconnects,
+// and failures to find a ready pod are retried with backoff.
+func (f *podForwarder) Run(ctx context.Context, readyCh chan struct{}, stopCh chan struct{}) error {
+	transport, upgrader, err := spdy.RoundTripperFor(f.config)
+	if err != nil {
+		return err
+	}
+
+	var readyOnce sync.Once
+	backoff := reconnectBackoff()
+	for {
+		pod, err := f.waitForReadyPod(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			// the API server going away for a moment must not end the tunnel
+			fmt.Fprintf(f.status, "Failed to look up the %s pods (%v), retrying\n", f.name, err)
+			if !sleepOrDone(ctx, stopCh, backoff.Step()) {
+				return nil
+			}
+			continue
+		}
+
+		ports, err := f.podPorts(pod)
+		if err != nil {
+			return err
+		}
+
+		podPath := f.client.CoreV1().RESTClient().Post().Resource("pods").Namespace(f.namespace).Name(pod.Name).SubResource("portforward")
+
+		dialer := spdy.NewDialer(
+			upgrader,
+			&http.Client{Transport: transport},
+			http.MethodPost,
+			podPath.URL(),
+		)
+
+		podStopCh := make(chan struct{})
+		podReadyCh := make(chan struct{})
+		portForwarder, err := portforward.NewOnAddresses(dialer, []string{f.address}, ports, podStopCh, podReadyCh, f.out, f.status)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(f.status, "Forwarding to %s pod %s\n", f.name, pod.Name)
+
+		forwardErrCh := make(chan error, 1)
+		go func() {
+			forwardErrCh <- portForwarder.ForwardPorts()
+		}()
+
+		podCtx, podCancel := context.WithCancel(ctx)
+		goneCh := f.watchPodGone(podCtx, pod.Name)
+
+		// the dial is not cancellable, an interrupt leaves it behind rather than waiting on it
+		select {
+		case <-podReadyCh:
+			f.keepLocalPorts(portForwarder)
+			readyOnce.Do(func() { close(readyCh) })
+			backoff = reconnectBackoff()
+		case <-ctx.Done():
+			close(podStopCh)
+			podCancel()
+			return nil
+		case <-stopCh:
+			close(podStopCh)
+			podCancel()
+			return nil
+		case err := <-forwardErrCh:
+			podCancel()
+			if !errors.Is(err, portforward.ErrLostConnectionToPod) {
+				return err
+			}
+			if !sleepOrDone(ctx, stopCh, backoff.Step()) {
+				return nil
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			close(podStopCh)
+			<-forwardErrCh
+			podCancel()
+			fmt.Fprintf(f.status, "Closing %s tunnel\n", f.name)
+			return nil
+		case <-stopCh:
+			close(podStopCh)
+			<-forwardErrCh
+			podCancel()
+			return nil
+		case <-goneCh:
+			close(podStopCh)
+			<-forwardErrCh
+			fmt.Fprintf(f.status, "The %s pod %s is no longer available, reconnecting\n", f.name, pod.Name)
+		case err := <-forwardErrCh:
+			fmt.Fprintf(f.status, "Lost connection to %s pod %s (%v), reconnecting\n", f.name, pod.Name, err)
+		}
+		podCancel()
+
+		if !sleepOrDone(ctx, stopCh, backoff.Step()) {
+			return nil
+		}
+	}
+}
+
+// reconnectBackoff spaces the reconnects of a tunnel that keeps failing, up to 30s apart
+func reconnectBackoff() wait.Backoff {
+	return wait.Backoff{Duration: 500 * time.Millisecond, Factor: 2, Jitter: 0.1, Steps: 10, Cap: 30 * time.Second}
+}
+
+// sleepOrDone waits for delay, returning false when ctx is done or stopCh closed first
+func sleepOrDone(ctx context.Context, stopCh chan struct{}, delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-stopCh:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// podPorts renders the local:remote pairs for the pod, looking up named ports in its containers
+func (f *podForwarder) podPorts(pod *corev1.Pod) ([]string, error) {
+	var ports []string
+	for _, port := range f.ports {
+		remote := port.remote.IntValue()
+		if port.remote.Type == intstr.String {
+			remote = 0
+			for _, container := range pod.Spec.Containers {
+				for _, containerPort := range container.Ports {
+					if containerPort.Name == port.remote.StrVal {
+						remote = int(containerPort.ContainerPort)
+					}
+				}
+			}
+			if remote == 0 {
+				return nil, fmt.Errorf("pod %s has no port named %s", pod.Name, port.remote.StrVal)
+			}
+		}
+		ports = append(ports, fmt.Sprintf("%d:%d", port.local, remote))
+	}
+	return ports, nil
+}
+
+// keepLocalPorts records the ports the kernel assigned, so a reconnect listens on the same ones
+func (f *podForwarder) keepLocalPorts(forwarder *portforward.PortForwarder) {
+	forwarded, err := forwarder.GetPorts()
+	if err != nil || len(forwarded) != len(f.ports) {
+		return
+	}
+	for i := range f.ports {
+		f.ports[i].local = int(forwarded[i].Local)
+	}
+}
+
+// waitForReadyPod returns a ready pod of the selector, polling until one is available
+func (f *podForwarder) waitForReadyPod(ctx context.Context) (*corev1.Pod, error) {
+	var ready *corev1.Pod
+	waiting := false
+
+	err := wait.PollUntilContextCancel(ctx, 2*time.Second, true, func(ctx context.Context) (bool, error) {
+		podList, err := f.client.CoreV1().Pods(f.namespace).List(ctx, v1.ListOptions{LabelSelector: f.selector.String()})
+		if err != nil {
+			return false, err
+		}
+
+		for i := range podList.Items {
+			if isPodReady(&podList.Items[i]) {
+				ready = &podList.Items[i]
+				return true, nil
+			}
+		}
+
+		if !waiting {
+			fmt.Fprintf(f.status, "Waiting for a ready %s pod\n", f.name)
+			waiting = true
+		}
+		return false, nil
+	})
+
+	return ready, err
+}
+
+// watchPodGone returns a channel that is closed when the pod is deleted, terminating or no longer ready
+func (f *podForwarder) watchPodGone(ctx context.Context, podName string) <-chan struct{} {
+	goneCh := make(chan struct{})
+
+	go func() {
+		for ctx.Err() == nil {
+			watcher, err := f.client.CoreV1().Pods(f.namespace).Watch(ctx, v1.ListOptions{
+				FieldSelector: fields.OneTermEqualSelector("metadata.name", podName).String(),
+			})
+			if err != nil {
+				// the port-forward itself will report a lost connection
+				return
+			}
+
+			for event := range watcher.ResultChan() {
+				pod, ok := event.Object.(*corev1.Pod)
+				if !ok {
+					continue
+				}
+				if event.Type == watch.Deleted || !isPodReady(pod) {
+					watcher.Stop()
+					close(goneCh)
+					return
+				}
+			}
+			watcher.Stop()
+		}
+	}()
+
+	return goneCh
+}
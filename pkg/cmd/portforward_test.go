@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParsePortSpec(t *testing.T) {
+	tests := []struct {
+		spec       string
+		wantLocal  int
+		wantRemote string
+		wantErr    bool
+	}{
+		{spec: "4222", wantLocal: -1, wantRemote: "4222"},
+		{spec: "client", wantLocal: -1, wantRemote: "client"},
+		{spec: "14222:4222", wantLocal: 14222, wantRemote: "4222"},
+		{spec: "8080:http", wantLocal: 8080, wantRemote: "http"},
+		{spec: ":4222", wantLocal: 0, wantRemote: "4222"},
+		{spec: "4222:", wantErr: true},
+		{spec: "abc:4222", wantErr: true},
+		{spec: "70000:4222", wantErr: true},
+		{spec: "-1:4222", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			local, remote, err := parsePortSpec(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePortSpec(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if local != tt.wantLocal || remote != tt.wantRemote {
+				t.Errorf("parsePortSpec(%q) = %d, %q, want %d, %q", tt.spec, local, remote, tt.wantLocal, tt.wantRemote)
+			}
+		})
+	}
+}
+
+func TestResolvePortForward(t *testing.T) {
+	service := func(name string, selector map[string]string, ports ...corev1.ServicePort) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: v1.ObjectMeta{Name: name, Namespace: cosmonicNamespace},
+			Spec:       corev1.ServiceSpec{Selector: selector, Ports: ports},
+		}
+	}
+	selector := map[string]string{"app": "nats"}
+	objects := []runtime.Object{
+		service("cosmonic-control-nats", selector,
+			corev1.ServicePort{Name: "client", Port: 4222, TargetPort: intstr.FromString("client")},
+			corev1.ServicePort{Name: "monitor", Port: 8222, TargetPort: intstr.FromInt(18222)},
+		),
+		service("api", map[string]string{"app": "api"}, corev1.ServicePort{Name: "web", Port: 80}),
+		service("headless", nil, corev1.ServicePort{Name: "web", Port: 80}),
+		service("grafana", map[string]string{"app": "grafana"}, corev1.ServicePort{Name: "http", Port: 3000}),
+	}
+
+	tests := []struct {
+		name        string
+		target      string
+		specs       []string
+		wantService string
+		wantPorts   []forwardPort
+		wantErr     bool
+	}{
+		{
+			name:        "built-in target matched by release suffix and port name",
+			target:      "nats",
+			wantService: "cosmonic-control-nats",
+			wantPorts:   []forwardPort{{local: 4222, remote: intstr.FromString("client")}},
+		},
+		{
+			name:        "service name with every port",
+			target:      "cosmonic-control-nats",
+			wantService: "cosmonic-control-nats",
+			wantPorts: []forwardPort{
+				{local: 4222, remote: intstr.FromString("client")},
+				{local: 8222, remote: intstr.FromInt(18222)},
+			},
+		},
+		{
+			name:        "port specs by name and number",
+			target:      "cosmonic-control-nats",
+			specs:       []string{"monitor", "14222:4222"},
+			wantService: "cosmonic-control-nats",
+			wantPorts: []forwardPort{
+				{local: 8222, remote: intstr.FromInt(18222)},
+				{local: 14222, remote: intstr.FromString("client")},
+			},
+		},
+		{
+			name:        "port the service does not expose",
+			target:      "api",
+			specs:       []string{"9090", "0:9091"},
+			wantService: "api",
+			wantPorts: []forwardPort{
+				{local: 9090, remote: intstr.FromInt(9090)},
+				{local: 0, remote: intstr.FromInt(9091)},
+			},
+		},
+		{name: "unknown port name", target: "api", specs: []string{"grpc"}, wantErr: true},
+		{name: "unknown service", target: "missing", wantErr: true},
+		{name: "service without selector", target: "headless", wantErr: true},
+		{name: "built-in target without a service", target: "metrics", wantErr: true},
+		{name: "built-in target ignores other services with its port names", target: "nexus", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forward, err := resolvePortForward(context.Background(), fake.NewClientset(objects...), tt.target, tt.specs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolvePortForward() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if forward.service != tt.wantService {
+				t.Errorf("resolvePortForward() service = %s, want %s", forward.service, tt.wantService)
+			}
+			if !reflect.DeepEqual(forward.ports, tt.wantPorts) {
+				t.Errorf("resolvePortForward() ports = %+v, want %+v", forward.ports, tt.wantPorts)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	chartManager "github.com/cosmonic/kubectl-cosmo/pkg/internal/chartmanager"
+	"github.com/spf13/pflag"
+	"k8s.io/client-go/util/homedir"
+)
+
+// releaseFlags are the install and update flags that customize how a chart is rendered
+type releaseFlags struct {
+	postRenderer     string
+	postRendererArgs []string
+	kustomize        string
+	labels           map[string]string
+	annotations      map[string]string
+	verify           bool
+	keyring          string
+	signatureKeys    []string
+	imageRegistry    string
+	imagePullSecret  string
+	resetRender      bool
+}
+
+func (f *releaseFlags) addFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&f.postRenderer, "post-renderer", "", "binary the rendered manifests are piped through before they are applied")
+	flags.StringArrayVar(&f.postRendererArgs, "post-renderer-args", nil, "argument passed to the post-renderer, can be repeated")
+	flags.StringVar(&f.kustomize, "kustomize", "", "directory with a kustomization applied to the rendered manifests")
+	flags.StringToStringVar(&f.labels, "labels", nil, "labels stamped onto every rendered object and pod template, as key=value pairs")
+	flags.StringToStringVar(&f.annotations, "annotations", nil, "annotations stamped onto every rendered object and pod template, as key=value pairs")
+	flags.BoolVar(&f.verify, "verify", false, "verify the helm provenance file of the chart before using it")
+	flags.StringVar(&f.keyring, "keyring", defaultKeyring(), "keyring containing the public keys used by --verify")
+	flags.StringArrayVar(&f.signatureKeys, "cosign-key", nil, "PEM public key file the cosign signature of the chart must verify against, can be repeated")
+	flags.StringVar(&f.imageRegistry, "image-registry", "", "mirror registry every rendered container image is rewritten to, such as registry.example.com/cosmonic")
+	flags.StringVar(&f.imagePullSecret, "image-pull-secret", "", "image pull secret attached to every rendered pod")
+	flags.BoolVar(&f.resetRender, "reset-render-options", false, "render with the given render options only, dropping the ones stored with the release by earlier installs and updates")
+}
+
+// options converts the flags to chart manager release options
+func (f *releaseFlags) options() (chartManager.ReleaseOptions, error) {
+	if f.kustomize != "" {
+		if info, err := os.Stat(f.kustomize); err != nil || !info.IsDir() {
+			return chartManager.ReleaseOptions{}, fmt.Errorf("--kustomize %s is not a directory", f.kustomize)
+		}
+	}
+
+	return chartManager.ReleaseOptions{
+		PostRenderer:       f.postRenderer,
+		PostRendererArgs:   f.postRendererArgs,
+		Kustomize:          f.kustomize,
+		Labels:             f.labels,
+		Annotations:        f.annotations,
+		Verify:             f.verify,
+		Keyring:            f.keyring,
+		SignatureKeys:      f.signatureKeys,
+		ImageRegistry:      f.imageRegistry,
+		ImagePullSecret:    f.imagePullSecret,
+		ResetRenderOptions: f.resetRender,
+	}, nil
+}
+
+// defaultKeyring is the gpg public keyring helm uses by default
+func defaultKeyring() string {
+	if v, ok := os.LookupEnv("GNUPGHOME"); ok {
+		return filepath.Join(v, "pubring.gpg")
+	}
+	return filepath.Join(homedir.HomeDir(), ".gnupg", "pubring.gpg")
+}
@@ -0,0 +1,246 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	chartManager "github.com/cosmonic/kubectl-cosmo/pkg/internal/chartmanager"
+	"github.com/cosmonic/kubectl-cosmo/pkg/internal/license"
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/genericiooptions"
+	"k8s.io/client-go/kubernetes"
+)
+
+// upStep is one idempotent step of the bootstrap, skipped when done reports it has already happened
+type upStep struct {
+	name string
+	done func(ctx context.Context) (bool, error)
+	run  func(ctx context.Context) error
+}
+
+type UpConfig struct {
+	manager     *chartManager.ChartManager
+	client      kubernetes.Interface
+	configFlags *genericclioptions.ConfigFlags
+	licenseFile string
+	timeout     time.Duration
+	noConsole   bool
+	noBrowser   bool
+	genericiooptions.IOStreams
+
+	logger *log.Logger
+}
+
+func NewCmdUp(streams genericiooptions.IOStreams) *cobra.Command {
+	up := &UpConfig{configFlags: genericclioptions.NewConfigFlags(true), IOStreams: streams, logger: log.Default()}
+
+	cmd := &cobra.Command{
+		Use:   "up [flags]",
+		Short: "Bootstrap a full Cosmonic Control environment in the cluster",
+		Long: `Installs the nexus, waits for it, installs a default hostgroup, optionally applies a license,
+checks the platform health and opens the console. Steps that have already completed are skipped,
+so up can be run again to resume after a failure.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := up.Initialize(cmd, args); err != nil {
+				return err
+			}
+
+			return up.Run(cmd)
+		},
+	}
+
+	cmd.Flags().StringVar(&up.licenseFile, "license-file", "", "file containing a license key to apply")
+	cmd.Flags().DurationVar(&up.timeout, "timeout", 10*time.Minute, "how long to wait for each component to become ready")
+	cmd.Flags().BoolVar(&up.noConsole, "no-console", false, "do not open the console once the platform is ready")
+	cmd.Flags().BoolVar(&up.noBrowser, "no-browser", false, "print the console URL instead of prompting to open a browser")
+
+	return cmd
+}
+
+// Initialize configures the chart manager and kubernetes client
+func (up *UpConfig) Initialize(cmd *cobra.Command, args []string) error {
+	helmDriver := os.Getenv("HELM_DRIVER")
+	manager, err := chartManager.New(up.IOStreams, helmDriver, log.Default())
+	if err != nil {
+		return err
+	}
+	up.manager = manager
+
+	client, _, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+	up.client = client
+
+	return nil
+}
+
+// Run executes every step in order, stopping at the first failure
+func (up *UpConfig) Run(cmd *cobra.Command) error {
+	ctx := cmd.Context()
+
+	steps := []upStep{
+		{
+			name: "install nexus",
+			done: up.installed(controlChartName),
+			run: func(ctx context.Context) error {
+				return up.manager.Install(ctx, controlChartName, controlChartName)
+			},
+		},
+		{
+			name: "wait for nexus",
+			done: up.ready(controlChartName),
+			run: func(ctx context.Context) error {
+				return waitForRelease(ctx, up.client, cosmonicNamespace, controlChartName, up.timeout)
+			},
+		},
+		{
+			name: "install default hostgroup",
+			done: up.installed(hostgroupInstalledChartName),
+			run: func(ctx context.Context) error {
+				return up.manager.Install(ctx, hostgroupInstalledChartName, hostgroupRepoChartName)
+			},
+		},
+		{
+			name: "wait for hostgroup",
+			done: up.ready(hostgroupInstalledChartName),
+			run: func(ctx context.Context) error {
+				return waitForRelease(ctx, up.client, cosmonicNamespace, hostgroupInstalledChartName, up.timeout)
+			},
+		},
+	}
+
+	if len(up.licenseFile) > 0 {
+		steps = append(steps, upStep{
+			name: "apply license",
+			done: up.licenseApplied,
+			run:  up.applyLicense,
+		})
+	}
+
+	steps = append(steps, upStep{
+		name: "check platform health",
+		done: func(ctx context.Context) (bool, error) { return false, nil },
+		run:  up.healthCheck,
+	})
+
+	for i, step := range steps {
+		prefix := fmt.Sprintf("[%d/%d] %s", i+1, len(steps), step.name)
+
+		done, err := step.done(ctx)
+		if err != nil {
+			return fmt.Errorf("%s: %w", prefix, err)
+		}
+		if done {
+			fmt.Fprintf(up.Out, "%s: already done\n", prefix)
+			continue
+		}
+
+		fmt.Fprintf(up.Out, "%s...\n", prefix)
+		if err := step.run(ctx); err != nil {
+			return fmt.Errorf("%s failed, run up again to resume: %w", prefix, err)
+		}
+	}
+
+	fmt.Fprintln(up.Out, "Cosmonic Control is up")
+
+	if up.noConsole {
+		return nil
+	}
+	return up.openConsole(cmd)
+}
+
+func (up *UpConfig) installed(releaseName string) func(ctx context.Context) (bool, error) {
+	return func(ctx context.Context) (bool, error) {
+		_, err := up.manager.GetRelease(releaseName)
+		if errors.Is(err, chartManager.ErrReleaseNotFound) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+}
+
+func (up *UpConfig) ready(releaseName string) func(ctx context.Context) (bool, error) {
+	return func(ctx context.Context) (bool, error) {
+		return releaseReady(ctx, up.client, cosmonicNamespace, releaseName)
+	}
+}
+
+// licenseApplied reports whether the cluster already holds the license of the key file, matched on
+// licensee and expiry like apply does
+func (up *UpConfig) licenseApplied(ctx context.Context) (bool, error) {
+	key, err := os.ReadFile(up.licenseFile)
+	if err != nil {
+		return false, err
+	}
+	desired, err := license.Decode(string(key))
+	if err != nil {
+		return false, err
+	}
+
+	// a missing or unreadable license is applied, the step itself reports why the cluster refuses it
+	current, err := license.Load(ctx, up.client, cosmonicNamespace)
+	if err != nil {
+		return false, nil
+	}
+	return sameLicense(current, desired), nil
+}
+
+func (up *UpConfig) applyLicense(ctx context.Context) error {
+	key, err := os.ReadFile(up.licenseFile)
+	if err != nil {
+		return err
+	}
+
+	lic, err := license.Apply(ctx, up.client, cosmonicNamespace, string(key))
+	if err != nil {
+		return err
+	}
+	forgetCachedLicense()
+
+	fmt.Fprintf(up.Out, "license for %s applied, expires %s\n", lic.Licensee, lic.ExpiresAt.Format(time.DateOnly))
+	return nil
+}
+
+// healthCheck waits for every release to be ready and the console deployment to serve
+func (up *UpConfig) healthCheck(ctx context.Context) error {
+	for _, releaseName := range []string{controlChartName, hostgroupInstalledChartName} {
+		if err := waitForRelease(ctx, up.client, cosmonicNamespace, releaseName, up.timeout); err != nil {
+			return err
+		}
+	}
+
+	console := &ConsoleConfig{configFlags: up.configFlags, IOStreams: up.IOStreams}
+	hasConsole, err := console.verifyConsoleDeployment()
+	if err != nil {
+		return err
+	}
+	if !hasConsole {
+		return fmt.Errorf("console deployment has no ready replicas")
+	}
+	return nil
+}
+
+func (up *UpConfig) openConsole(cmd *cobra.Command) error {
+	console := &ConsoleConfig{
+		configFlags: up.configFlags,
+		IOStreams:   up.IOStreams,
+		localPort:   startPort,
+		address:     "localhost",
+		noBrowser:   up.noBrowser,
+	}
+
+	if err := console.Complete(cmd, nil); err != nil {
+		return err
+	}
+	if err := console.Validate(); err != nil {
+		return err
+	}
+	return console.Run()
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cosmonic/kubectl-cosmo/pkg/internal/license"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestLicenseApplied(t *testing.T) {
+	licenseKey := func(claims string) string {
+		header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"EdDSA","typ":"JWT"}`))
+		return header + "." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".signature"
+	}
+	installed := func(key string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: v1.ObjectMeta{Name: license.SecretName, Namespace: cosmonicNamespace},
+			Data:       map[string][]byte{license.SecretKey: []byte(key)},
+		}
+	}
+
+	desired := licenseKey(`{"licensee":"Acme","exp":1893456000}`)
+	keyFile := filepath.Join(t.TempDir(), "license.key")
+	if err := os.WriteFile(keyFile, []byte(desired), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		objects []runtime.Object
+		want    bool
+	}{
+		{name: "not installed"},
+		{name: "same license", objects: []runtime.Object{installed(desired)}, want: true},
+		{name: "renewed license", objects: []runtime.Object{installed(licenseKey(`{"licensee":"Acme","exp":1861920000}`))}},
+		{name: "other licensee", objects: []runtime.Object{installed(licenseKey(`{"licensee":"Initech","exp":1893456000}`))}},
+		{name: "unreadable license", objects: []runtime.Object{installed("garbage")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			up := &UpConfig{client: fake.NewClientset(tt.objects...), licenseFile: keyFile}
+			got, err := up.licenseApplied(context.Background())
+			if err != nil {
+				t.Fatalf("licenseApplied() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("licenseApplied() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	chartManager "github.com/cosmonic/kubectl-cosmo/pkg/internal/chartmanager"
 	"github.com/spf13/cobra"
@@ -16,6 +17,7 @@ import (
 type VersionConfig struct {
 	manager     *chartManager.ChartManager
 	configFlags *genericclioptions.ConfigFlags
+	output      string
 	genericiooptions.IOStreams
 
 	settings *cli.EnvSettings
@@ -44,6 +46,8 @@ func NewCmdVersion(streams genericiooptions.IOStreams) *cobra.Command {
 		},
 	}
 
+	cmd.Flags().StringVarP(&versionCfg.output, "output", "o", "", "output format, one of json or yaml")
+
 	return cmd
 }
 
@@ -62,36 +66,67 @@ func (verCfg *VersionConfig) Initialize(cmd *cobra.Command, args []string) error
 
 // Valdiate checks the configuration
 func (verCfg *VersionConfig) Validate() error {
-	return nil
+	return validateOutputFormat(verCfg.output)
+}
+
+// componentVersion is the installed and available chart version of a component
+type componentVersion struct {
+	Component string `json:"component"`
+	Installed string `json:"installed"`
+	Available string `json:"available"`
+}
+
+// versionInfo is the structured output of the version command
+type versionInfo struct {
+	Components    []componentVersion `json:"components"`
+	LicenseExpiry *time.Time         `json:"licenseExpiry,omitempty"`
 }
 
 // Default nexus command will display the installed version and the latest available repo version for nexus and hostgroups
 func (verCfg *VersionConfig) Run() error {
 	ctx := context.Background()
 
-	logTo, err := verCfg.logChartVersion(ctx, "nexus control", controlChartName, controlChartName)
+	info := versionInfo{}
+
+	nexusVer, err := verCfg.chartVersion(ctx, "nexus control", controlChartName, controlChartName)
 	if err != nil {
 		return err
 	}
-	fmt.Println(logTo)
+	info.Components = append(info.Components, nexusVer)
 
-	logTo, err = verCfg.logChartVersion(ctx, "hostgroup", hostgroupInstalledChartName, hostgroupRepoChartName)
+	hostgroupVer, err := verCfg.chartVersion(ctx, "hostgroup", hostgroupInstalledChartName, hostgroupRepoChartName)
 	if err != nil {
 		return err
 	}
-	fmt.Println(logTo)
-	return nil
+	info.Components = append(info.Components, hostgroupVer)
+
+	if lic, err := installedLicense(ctx); err == nil {
+		info.LicenseExpiry = &lic.ExpiresAt
+	}
+
+	switch verCfg.output {
+	case "":
+		for _, component := range info.Components {
+			fmt.Fprintf(verCfg.Out, "component %s: installed [%s], available [%s]\n", component.Component, component.Installed, component.Available)
+		}
+		if info.LicenseExpiry != nil {
+			fmt.Fprintf(verCfg.Out, "license: expires [%s]\n", info.LicenseExpiry.Format(time.DateOnly))
+		}
+		return nil
+	default:
+		return printStructured(verCfg.Out, verCfg.output, info)
+	}
 }
 
-func (verCfg *VersionConfig) logChartVersion(ctx context.Context, componentName string, installedChartName string, repoChartName string) (string, error) {
+func (verCfg *VersionConfig) chartVersion(ctx context.Context, componentName string, installedChartName string, repoChartName string) (componentVersion, error) {
 	installedVer, err := verCfg.manager.GetInstalledChartVersion(installedChartName)
 	if err != nil {
-		return "", err
+		return componentVersion{}, err
 	}
 	repoVer, err := verCfg.manager.GetRepoChartVersion(ctx, repoChartName)
 	if err != nil {
-		return "", err
+		return componentVersion{}, err
 	}
 
-	return fmt.Sprintf("component %s: installed [%s], available [%s]", componentName, installedVer, repoVer), nil
+	return componentVersion{Component: componentName, Installed: installedVer, Available: repoVer}, nil
 }
@@ -6,15 +6,20 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"reflect"
 	"sort"
+	"strings"
 
 	"helm.sh/helm/v3/pkg/action"
 	"helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
 	"helm.sh/helm/v3/pkg/cli"
 	"helm.sh/helm/v3/pkg/downloader"
 	"helm.sh/helm/v3/pkg/getter"
 	"helm.sh/helm/v3/pkg/registry"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/cli-runtime/pkg/genericiooptions"
 	"k8s.io/client-go/tools/clientcmd/api"
@@ -26,6 +31,27 @@ const (
 	cosmonicChartRegistry = "oci://ghcr.io/cosmonic"
 )
 
+// Option configures a ChartManager
+type Option func(*ChartManager)
+
+// WithNamespace sets the namespace the releases are installed in
+func WithNamespace(namespace string) Option {
+	return func(manager *ChartManager) {
+		if namespace != "" {
+			manager.namespace = namespace
+		}
+	}
+}
+
+// WithRegistry sets the OCI registry the charts are pulled from, such as oci://ghcr.io/cosmonic
+func WithRegistry(registry string) Option {
+	return func(manager *ChartManager) {
+		if registry != "" {
+			manager.registry = "oci://" + strings.TrimSuffix(strings.TrimPrefix(registry, "oci://"), "/")
+		}
+	}
+}
+
 type ChartManager struct {
 	configFlags           *genericclioptions.ConfigFlags
 	resultingContext      *api.Context
@@ -40,11 +66,17 @@ type ChartManager struct {
 	settings   *cli.EnvSettings
 	helmAction *action.Configuration
 	logger     *log.Logger
+	namespace  string
+	registry   string
 }
 
 // pass  os.Getenv("HELM_DRIVER") for helmDriver
-func New(streams genericiooptions.IOStreams, helmDriver string, logger *log.Logger) (*ChartManager, error) {
-	manager := &ChartManager{configFlags: genericclioptions.NewConfigFlags(true), IOStreams: streams, logger: logger}
+func New(streams genericiooptions.IOStreams, helmDriver string, logger *log.Logger, opts ...Option) (*ChartManager, error) {
+	manager := &ChartManager{configFlags: genericclioptions.NewConfigFlags(true), IOStreams: streams, logger: logger,
+		namespace: cosmonicNamespace, registry: cosmonicChartRegistry}
+	for _, opt := range opts {
+		opt(manager)
+	}
 
 	// initialize
 	manager.settings = cli.New()
@@ -53,7 +85,7 @@ func New(streams genericiooptions.IOStreams, helmDriver string, logger *log.Logg
 	manager.helmAction = new(action.Configuration)
 	if err := manager.helmAction.Init(
 		manager.settings.RESTClientGetter(),
-		cosmonicNamespace,
+		manager.namespace,
 		helmDriver,
 		logger.Printf); err != nil {
 		return nil, err
@@ -101,9 +133,64 @@ func (manager *ChartManager) GetInstalledChartVersion(chartName string) (string,
 	return "", errors.New("chart not found")
 }
 
+// ErrReleaseNotFound is returned by GetRelease when the release is not installed
+var ErrReleaseNotFound = driver.ErrReleaseNotFound
+
+// ErrUpToDate is returned by Update when the release already runs the latest chart version
+var ErrUpToDate = errors.New("chart is already at the latest version")
+
+// GetRelease returns the latest revision of the named release
+func (manager *ChartManager) GetRelease(releaseName string) (*release.Release, error) {
+	rel, err := action.NewGet(manager.helmAction).Run(releaseName)
+	if errors.Is(err, driver.ErrReleaseNotFound) {
+		return nil, ErrReleaseNotFound
+	}
+	return rel, err
+}
+
+// Namespace is the namespace the releases are installed in
+func (manager *ChartManager) Namespace() string {
+	return manager.namespace
+}
+
+// Registry is the OCI registry the charts are pulled from, including the oci:// scheme
+func (manager *ChartManager) Registry() string {
+	return manager.registry
+}
+
+// Values returns the values an install or upgrade with opts passes to helm
+func (manager *ChartManager) Values(opts ReleaseOptions) map[string]interface{} {
+	values := map[string]interface{}{}
+	for k, v := range opts.Values {
+		values[k] = v
+	}
+	return values
+}
+
+// ListReleases returns the names of the deployed releases of the chart
+func (manager *ChartManager) ListReleases(chartName string) ([]string, error) {
+	listClient := action.NewList(manager.helmAction)
+	listClient.All = true
+	listClient.SetStateMask()
+
+	results, err := listClient.Run()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run list action: %w", err)
+	}
+
+	var releases []string
+	for _, rel := range results {
+		if rel.Chart != nil && rel.Chart.Metadata != nil && rel.Chart.Metadata.Name == chartName {
+			releases = append(releases, rel.Name)
+		}
+	}
+
+	return releases, nil
+}
+
 func (manager *ChartManager) GetRepoChartVersion(ctx context.Context, chartName string) (string, error) {
 
-	repo, err := remote.NewRepository(fmt.Sprintf("ghcr.io/cosmonic/%s", chartName))
+	repo, err := remote.NewRepository(strings.TrimPrefix(manager.chartRegistryName(chartName), "oci://"))
 	if err != nil {
 		return "", err
 	}
@@ -168,32 +255,98 @@ func (manager *ChartManager) CheckDependencies(chart *chart.Chart, registryClien
 }
 
 func (manager *ChartManager) chartRegistryName(chartName string) string {
-	return fmt.Sprintf("%s/%s", cosmonicChartRegistry, chartName)
+	return fmt.Sprintf("%s/%s", manager.registry, chartName)
 }
 
-func (manager *ChartManager) Install(ctx context.Context, chartName string) error {
-	// check if chart is already installed
-	if ver, err := manager.GetInstalledChartVersion(chartName); err == nil && ver != "" {
+// ReleaseOptions configures the chart version and values of an install or upgrade
+type ReleaseOptions struct {
+	// Version is the chart version, the latest in the registry when empty
+	Version string
+	// Values are the user supplied values for the release
+	Values map[string]interface{}
+	// PostRenderer is a binary the rendered manifests are piped through, with PostRendererArgs
+	PostRenderer     string
+	PostRendererArgs []string
+	// Kustomize is a directory with a kustomization applied to the rendered manifests
+	Kustomize string
+	// Labels and Annotations are stamped onto every rendered object and pod template
+	Labels      map[string]string
+	Annotations map[string]string
+	// Verify checks the helm provenance file of the chart against Keyring
+	Verify  bool
+	Keyring string
+	// SignatureKeys are public key files the cosign signature of the chart artifact must verify against
+	SignatureKeys []string
+	// ImageRegistry replaces the registry of every rendered container image, ImagePullSecret is
+	// added to every pod spec
+	ImageRegistry   string
+	ImagePullSecret string
+	// RequiredValues are dotted value paths the chart must declare in its values or values schema
+	RequiredValues []string
+	// ResetRenderOptions renders an upgrade with the render options above only, instead of adding the
+	// ones stored with the release
+	ResetRenderOptions bool
+}
+
+// Install installs the latest version of the chart from the Cosmonic registry as releaseName
+func (manager *ChartManager) Install(ctx context.Context, releaseName string, chartName string) error {
+	return manager.InstallRelease(ctx, releaseName, chartName, ReleaseOptions{})
+}
+
+// InstallRelease installs the chart as releaseName with the version and values in opts
+func (manager *ChartManager) InstallRelease(ctx context.Context, releaseName string, chartName string, opts ReleaseOptions) error {
+	// check if the release is already installed, by its exact name
+	_, err := manager.GetRelease(releaseName)
+	if err == nil {
 		return errors.New("chart is already installed")
 	}
-
-	releaseVersion, err := manager.GetRepoChartVersion(ctx, chartName)
-	if err != nil {
+	if !errors.Is(err, ErrReleaseNotFound) {
 		return err
 	}
 
+	releaseVersion := opts.Version
+	if releaseVersion == "" {
+		releaseVersion, err = manager.GetRepoChartVersion(ctx, chartName)
+		if err != nil {
+			return err
+		}
+	}
+
 	installClient := action.NewInstall(manager.helmAction)
 	installClient.DryRunOption = "none" // set this if flag passed for export
-	installClient.ReleaseName = "cosmonic-control"
+	installClient.ReleaseName = releaseName
+	installClient.Namespace = manager.namespace
+	installClient.CreateNamespace = true
 	installClient.Version = releaseVersion
 
+	installClient.PostRenderer, err = postRenderer(opts)
+	if err != nil {
+		return err
+	}
+
+	// refuse unsigned charts before anything is pulled or reaches the cluster
+	var verifiedDigest string
+	if len(opts.SignatureKeys) > 0 {
+		if verifiedDigest, err = manager.VerifyChartSignature(ctx, chartName, releaseVersion, opts.SignatureKeys); err != nil {
+			return err
+		}
+	}
+	installClient.ChartPathOptions.Verify = opts.Verify
+	if opts.Keyring != "" {
+		installClient.ChartPathOptions.Keyring = opts.Keyring
+	}
+
 	registryClient, err := newRegistryClient(manager.settings, false)
 	if err != nil {
 		return err
 	}
 	installClient.SetRegistryClient(registryClient)
 
+	// pull the manifest that was verified rather than whatever the tag points at by now
 	registryName := manager.chartRegistryName(chartName)
+	if verifiedDigest != "" {
+		registryName += "@" + verifiedDigest
+	}
 	chartPath, err := installClient.ChartPathOptions.LocateChart(registryName, manager.settings)
 	if err != nil {
 		return err
@@ -208,15 +361,19 @@ func (manager *ChartManager) Install(ctx context.Context, chartName string) erro
 		installClient.ChartPathOptions.Keyring); err != nil {
 		return err
 	}
+	if err := checkRequiredValues(chart, opts.RequiredValues); err != nil {
+		return err
+	}
 
-	// TODO need the values to pass in
-	var releaseValues map[string]interface{}
-
-	_, err = installClient.RunWithContext(ctx, chart, releaseValues)
+	_, err = installClient.RunWithContext(ctx, chart, manager.Values(opts))
 
 	if err != nil {
 		return err
 	}
+
+	if err := manager.saveRenderOptions(ctx, releaseName, opts); err != nil {
+		return fmt.Errorf("%s was installed but its render options could not be stored: %w", releaseName, err)
+	}
 	return nil
 }
 
@@ -232,15 +389,22 @@ func (manager *ChartManager) UnInstall(chartName string) error {
 		return err
 	}
 
-	if result != nil {
-		return fmt.Errorf("uninstall returned %v", result)
+	if result != nil && result.Info != "" {
+		manager.logger.Printf("uninstall %s: %s", chartName, result.Info)
+	}
+
+	if err := manager.removeRenderOptions(context.Background(), chartName); err != nil {
+		return fmt.Errorf("failed to remove the render options of %s: %w", chartName, err)
 	}
 
 	// TODO remove cosmonic-system namespace
 	return nil
 }
 
-func (manager *ChartManager) Update(chartName string) error {
+// Update upgrades releaseName to the latest version of the chart in the Cosmonic registry, opts.Version is ignored.
+// The values of the installed release are kept, opts.Values overriding them. When the chart is current
+// and opts change the stored render options, the release is upgraded at its installed version instead.
+func (manager *ChartManager) Update(releaseName string, chartName string, opts ReleaseOptions) error {
 	ctx := context.Background()
 
 	// get latest version from oci registry
@@ -248,23 +412,80 @@ func (manager *ChartManager) Update(chartName string) error {
 	if err != nil {
 		return err
 	}
-	// get version of helm chart installed
-	installedVersion, err := manager.GetInstalledChartVersion(chartName)
+	// get the installed release by its exact name
+	rel, err := manager.GetRelease(releaseName)
+	if err != nil {
+		return err
+	}
+	installedVersion := ""
+	if rel.Chart != nil && rel.Chart.Metadata != nil {
+		installedVersion = rel.Chart.Metadata.Version
+	}
+
+	stored, err := manager.loadRenderOptions(ctx, releaseName)
 	if err != nil {
 		return err
 	}
 
-	// if no update available then return
+	// if no update available then return, unless opts are to be applied at the installed version
 	if repoVersion == installedVersion || installedVersion > repoVersion {
-		return fmt.Errorf("chart is already at the latest version %s", repoVersion)
+		if reflect.DeepEqual(renderOptionsOf(withStoredRenderOptions(opts, stored)), stored) {
+			return fmt.Errorf("%w %s", ErrUpToDate, repoVersion)
+		}
+		repoVersion = installedVersion
+	}
+
+	opts.Version = repoVersion
+	opts.Values = chartutil.MergeTables(manager.Values(opts), rel.Config)
+	return manager.UpgradeRelease(ctx, releaseName, chartName, opts)
+}
+
+// UpgradeRelease upgrades releaseName to the chart version and values in opts, rendered with the
+// render options stored for the release unless opts set them or ask to reset them
+func (manager *ChartManager) UpgradeRelease(ctx context.Context, releaseName string, chartName string, opts ReleaseOptions) error {
+	stored, err := manager.loadRenderOptions(ctx, releaseName)
+	if err != nil {
+		return err
+	}
+	opts = withStoredRenderOptions(opts, stored)
+	// a stored kustomization lives on the machine the release was last rendered on
+	if opts.Kustomize != "" {
+		if info, err := os.Stat(opts.Kustomize); err != nil || !info.IsDir() {
+			return fmt.Errorf("kustomization %s of %s is not a directory, pass --kustomize or --reset-render-options", opts.Kustomize, releaseName)
+		}
+	}
+
+	releaseVersion := opts.Version
+	if releaseVersion == "" {
+		releaseVersion, err = manager.GetRepoChartVersion(ctx, chartName)
+		if err != nil {
+			return err
+		}
 	}
 
 	// update
 	upgradeClient := action.NewUpgrade(manager.helmAction)
-	upgradeClient.Namespace = cosmonicNamespace
+	upgradeClient.Namespace = manager.namespace
 	// set dry-run if flag is set for export
 	upgradeClient.DryRunOption = "none"
-	upgradeClient.Version = repoVersion
+	upgradeClient.Version = releaseVersion
+
+	upgradeClient.PostRenderer, err = postRenderer(opts)
+	if err != nil {
+		return err
+	}
+
+	// refuse unsigned charts before anything is pulled or reaches the cluster
+	var verifiedDigest string
+	if len(opts.SignatureKeys) > 0 {
+		if verifiedDigest, err = manager.VerifyChartSignature(ctx, chartName, releaseVersion, opts.SignatureKeys); err != nil {
+			return err
+		}
+	}
+	upgradeClient.ChartPathOptions.Verify = opts.Verify
+	if opts.Keyring != "" {
+		upgradeClient.ChartPathOptions.Keyring = opts.Keyring
+	}
 
 	registryClient, err := newRegistryClient(manager.settings, false)
 	if err != nil {
@@ -273,7 +494,11 @@ func (manager *ChartManager) Update(chartName string) error {
 
 	upgradeClient.SetRegistryClient(registryClient)
 
+	// pull the manifest that was verified rather than whatever the tag points at by now
 	registryName := manager.chartRegistryName(chartName)
+	if verifiedDigest != "" {
+		registryName += "@" + verifiedDigest
+	}
 	chartPath, err := upgradeClient.ChartPathOptions.LocateChart(registryName, manager.settings)
 	if err != nil {
 		return err
@@ -288,10 +513,17 @@ func (manager *ChartManager) Update(chartName string) error {
 		upgradeClient.ChartPathOptions.Keyring); err != nil {
 		return err
 	}
+	if err := checkRequiredValues(chart, opts.RequiredValues); err != nil {
+		return err
+	}
 
-	// TODO need the values to pass in
-	var releaseValues map[string]interface{}
-	_, err = upgradeClient.RunWithContext(ctx, chartName, chart, releaseValues)
+	_, err = upgradeClient.RunWithContext(ctx, releaseName, chart, manager.Values(opts))
+	if err != nil {
+		return err
+	}
 
-	return err
+	if err := manager.saveRenderOptions(ctx, releaseName, opts); err != nil {
+		return fmt.Errorf("%s was upgraded but its render options could not be stored: %w", releaseName, err)
+	}
+	return nil
 }
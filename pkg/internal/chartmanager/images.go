@@ -0,0 +1,260 @@
+package chartManager
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"oras.land/oras-go/v2/registry/remote"
+)
+
+const (
+	// dockerHubRegistry is the registry of image references without a host
+	dockerHubRegistry = "docker.io"
+	// dockerHubEndpoint serves the registry API for docker.io
+	dockerHubEndpoint = "registry-1.docker.io"
+)
+
+// containerFields are the pod spec lists holding containers with an image
+var containerFields = []string{"initContainers", "containers", "ephemeralContainers"}
+
+// Image is a container image referenced by a chart, Digest is empty when it could not be resolved
+type Image struct {
+	Reference string `json:"image"`
+	Digest    string `json:"digest,omitempty"`
+}
+
+// imageRenderer points every container image at a mirror registry and attaches a pull secret to
+// every pod spec, regardless of what the chart values expose
+type imageRenderer struct {
+	registry   string
+	pullSecret string
+}
+
+func (r imageRenderer) Run(manifests *bytes.Buffer) (*bytes.Buffer, error) {
+	objects, err := decodeManifests(manifests)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, object := range objects {
+		path := podSpecPath(object.GetKind())
+		if path == nil {
+			continue
+		}
+		spec, found, err := unstructured.NestedMap(object.Object, path...)
+		if err != nil || !found {
+			continue
+		}
+
+		if r.registry != "" {
+			forEachContainer(spec, func(container map[string]interface{}) {
+				if image, ok := container["image"].(string); ok && image != "" {
+					container["image"] = RewriteImage(image, r.registry)
+				}
+			})
+		}
+		if r.pullSecret != "" {
+			addPullSecret(spec, r.pullSecret)
+		}
+
+		if err := unstructured.SetNestedMap(object.Object, spec, path...); err != nil {
+			return nil, err
+		}
+	}
+
+	return encodeManifests(objects)
+}
+
+// forEachContainer calls fn with every container of the pod spec, changes to the map are kept
+func forEachContainer(spec map[string]interface{}, fn func(container map[string]interface{})) {
+	for _, field := range containerFields {
+		containers, ok := spec[field].([]interface{})
+		if !ok {
+			continue
+		}
+		for _, c := range containers {
+			if container, ok := c.(map[string]interface{}); ok {
+				fn(container)
+			}
+		}
+	}
+}
+
+func addPullSecret(spec map[string]interface{}, name string) {
+	secrets, _ := spec["imagePullSecrets"].([]interface{})
+	for _, s := range secrets {
+		if secret, ok := s.(map[string]interface{}); ok && secret["name"] == name {
+			return
+		}
+	}
+	spec["imagePullSecrets"] = append(secrets, map[string]interface{}{"name": name})
+}
+
+// splitImage breaks an image reference into its registry host, repository path and the tag or
+// digest suffix, including the leading : or @. References without a host are on docker.io.
+func splitImage(image string) (host string, repository string, suffix string) {
+	name := image
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, suffix = name[:i], name[i:]
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, suffix = name[:i], name[i:]+suffix
+	}
+
+	first, rest, found := strings.Cut(name, "/")
+	if found && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		return first, rest, suffix
+	}
+	if !found {
+		name = "library/" + name
+	}
+	return dockerHubRegistry, name, suffix
+}
+
+// RewriteImage moves an image reference to registry, which may include a path prefix, keeping its
+// repository path and tag or digest. Images already in registry are returned unchanged.
+func RewriteImage(image string, registry string) string {
+	registry = strings.TrimSuffix(registry, "/")
+	if strings.HasPrefix(image, registry+"/") {
+		return image
+	}
+	_, repository, suffix := splitImage(image)
+	return registry + "/" + repository + suffix
+}
+
+// ResolveImageDigest looks up the manifest digest of an image in its registry. Images pinned by
+// digest are returned without a lookup.
+func ResolveImageDigest(ctx context.Context, image string) (string, error) {
+	host, repository, suffix := splitImage(image)
+	if i := strings.Index(suffix, "@"); i >= 0 {
+		return suffix[i+1:], nil
+	}
+
+	reference := strings.TrimPrefix(suffix, ":")
+	if reference == "" {
+		reference = "latest"
+	}
+	if host == dockerHubRegistry {
+		host = dockerHubEndpoint
+	}
+
+	repo, err := remote.NewRepository(host + "/" + repository)
+	if err != nil {
+		return "", err
+	}
+	desc, err := repo.Resolve(ctx, reference)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", image, err)
+	}
+	return desc.Digest.String(), nil
+}
+
+// RenderManifests renders the chart client side with the version, values and post renderers in
+// opts, without contacting the cluster. Hook manifests are included.
+func (manager *ChartManager) RenderManifests(ctx context.Context, releaseName string, chartName string, opts ReleaseOptions) (string, error) {
+	var err error
+	releaseVersion := opts.Version
+	if releaseVersion == "" {
+		releaseVersion, err = manager.GetRepoChartVersion(ctx, chartName)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	installClient := action.NewInstall(manager.helmAction)
+	installClient.DryRun = true
+	installClient.DryRunOption = "client"
+	installClient.ClientOnly = true
+	installClient.Replace = true
+	installClient.ReleaseName = releaseName
+	installClient.Namespace = manager.namespace
+	installClient.Version = releaseVersion
+
+	installClient.PostRenderer, err = postRenderer(opts)
+	if err != nil {
+		return "", err
+	}
+
+	registryClient, err := newRegistryClient(manager.settings, false)
+	if err != nil {
+		return "", err
+	}
+	installClient.SetRegistryClient(registryClient)
+
+	chartPath, err := installClient.ChartPathOptions.LocateChart(manager.chartRegistryName(chartName), manager.settings)
+	if err != nil {
+		return "", err
+	}
+
+	chart, err := loader.Load(chartPath)
+	if err != nil {
+		return "", err
+	}
+
+	if err := manager.CheckDependencies(chart, registryClient, chartPath,
+		installClient.ChartPathOptions.Keyring); err != nil {
+		return "", err
+	}
+
+	rel, err := installClient.RunWithContext(ctx, chart, manager.Values(opts))
+	if err != nil {
+		return "", err
+	}
+
+	manifests := rel.Manifest
+	for _, hook := range rel.Hooks {
+		manifests += "\n---\n" + hook.Manifest
+	}
+	return manifests, nil
+}
+
+// ListImages returns the sorted, unique container images the chart renders with opts. Digests are
+// resolved from the registries, an image whose digest cannot be resolved is returned without one
+// and the lookup error is reported through the manager logger.
+func (manager *ChartManager) ListImages(ctx context.Context, chartName string, opts ReleaseOptions) ([]Image, error) {
+	manifests, err := manager.RenderManifests(ctx, chartName, chartName, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	objects, err := decodeManifests(bytes.NewBufferString(manifests))
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	var references []string
+	for _, object := range objects {
+		path := podSpecPath(object.GetKind())
+		if path == nil {
+			continue
+		}
+		spec, found, err := unstructured.NestedMap(object.Object, path...)
+		if err != nil || !found {
+			continue
+		}
+		forEachContainer(spec, func(container map[string]interface{}) {
+			if image, ok := container["image"].(string); ok && image != "" && !seen[image] {
+				seen[image] = true
+				references = append(references, image)
+			}
+		})
+	}
+	sort.Strings(references)
+
+	images := make([]Image, 0, len(references))
+	for _, reference := range references {
+		digest, err := ResolveImageDigest(ctx, reference)
+		if err != nil {
+			manager.logger.Printf("%v", err)
+		}
+		images = append(images, Image{Reference: reference, Digest: digest})
+	}
+	return images, nil
+}
@@ -0,0 +1,97 @@
+package chartManager
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSplitImage(t *testing.T) {
+	tests := []struct {
+		image          string
+		wantHost       string
+		wantRepository string
+		wantSuffix     string
+	}{
+		{image: "nginx", wantHost: "docker.io", wantRepository: "library/nginx"},
+		{image: "nginx:1.27", wantHost: "docker.io", wantRepository: "library/nginx", wantSuffix: ":1.27"},
+		{image: "bitnami/nginx:1.27", wantHost: "docker.io", wantRepository: "bitnami/nginx", wantSuffix: ":1.27"},
+		{image: "ghcr.io/cosmonic/host:0.1.0", wantHost: "ghcr.io", wantRepository: "cosmonic/host", wantSuffix: ":0.1.0"},
+		{image: "localhost/host", wantHost: "localhost", wantRepository: "host"},
+		{image: "localhost:5000/cosmonic/host:dev", wantHost: "localhost:5000", wantRepository: "cosmonic/host", wantSuffix: ":dev"},
+		{image: "registry.example.com:5000/host", wantHost: "registry.example.com:5000", wantRepository: "host"},
+		{image: "ghcr.io/cosmonic/host@sha256:abc", wantHost: "ghcr.io", wantRepository: "cosmonic/host", wantSuffix: "@sha256:abc"},
+		{image: "ghcr.io/cosmonic/host:0.1.0@sha256:abc", wantHost: "ghcr.io", wantRepository: "cosmonic/host", wantSuffix: ":0.1.0@sha256:abc"},
+		{image: "nats@sha256:abc", wantHost: "docker.io", wantRepository: "library/nats", wantSuffix: "@sha256:abc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			host, repository, suffix := splitImage(tt.image)
+			if host != tt.wantHost || repository != tt.wantRepository || suffix != tt.wantSuffix {
+				t.Errorf("splitImage() = %q, %q, %q, want %q, %q, %q", host, repository, suffix, tt.wantHost, tt.wantRepository, tt.wantSuffix)
+			}
+		})
+	}
+}
+
+func TestRewriteImage(t *testing.T) {
+	tests := []struct {
+		image    string
+		registry string
+		want     string
+	}{
+		{image: "ghcr.io/cosmonic/host:0.1.0", registry: "mirror.example.com", want: "mirror.example.com/cosmonic/host:0.1.0"},
+		{image: "ghcr.io/cosmonic/host:0.1.0", registry: "mirror.example.com/cosmonic/", want: "mirror.example.com/cosmonic/cosmonic/host:0.1.0"},
+		{image: "nats:2.10", registry: "mirror.example.com", want: "mirror.example.com/library/nats:2.10"},
+		{image: "localhost:5000/host@sha256:abc", registry: "mirror.example.com", want: "mirror.example.com/host@sha256:abc"},
+		{image: "mirror.example.com/cosmonic/host:0.1.0", registry: "mirror.example.com", want: "mirror.example.com/cosmonic/host:0.1.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.image+" to "+tt.registry, func(t *testing.T) {
+			if got := RewriteImage(tt.image, tt.registry); got != tt.want {
+				t.Errorf("RewriteImage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImageRenderer(t *testing.T) {
+	manifests := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: host
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: init
+        image: busybox
+      containers:
+      - name: host
+        image: ghcr.io/cosmonic/host:0.1.0
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+data:
+  image: ghcr.io/cosmonic/host:0.1.0
+`
+
+	rendered, err := imageRenderer{registry: "mirror.example.com", pullSecret: "mirror-creds"}.Run(bytes.NewBufferString(manifests))
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	out := rendered.String()
+
+	for _, want := range []string{"image: mirror.example.com/library/busybox", "image: mirror.example.com/cosmonic/host:0.1.0", "name: mirror-creds"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("rendered manifests lack %q:\n%s", want, out)
+		}
+	}
+	if !strings.Contains(out, "image: ghcr.io/cosmonic/host:0.1.0") {
+		t.Errorf("the ConfigMap data was rewritten:\n%s", out)
+	}
+}
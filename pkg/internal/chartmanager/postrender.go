@@ -0,0 +1,238 @@
+package chartManager
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"helm.sh/helm/v3/pkg/postrender"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/yaml"
+)
+
+// renderedManifestsFile is the name the helm output is given inside the kustomization
+const renderedManifestsFile = "helm-rendered.yaml"
+
+// chainRenderer runs each post renderer on the output of the previous one
+type chainRenderer []postrender.PostRenderer
+
+func (c chainRenderer) Run(manifests *bytes.Buffer) (*bytes.Buffer, error) {
+	var err error
+	for _, renderer := range c {
+		manifests, err = renderer.Run(manifests)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return manifests, nil
+}
+
+// postRenderer builds the post renderer for the release options, nil when none is needed. An external
+// binary runs first, then the kustomization and the image rewriting, and the common metadata is stamped
+// on last so it also covers anything the others added.
+func postRenderer(opts ReleaseOptions) (postrender.PostRenderer, error) {
+	var chain chainRenderer
+
+	if opts.PostRenderer != "" {
+		renderer, err := postrender.NewExec(opts.PostRenderer, opts.PostRendererArgs...)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, renderer)
+	}
+
+	if opts.Kustomize != "" {
+		chain = append(chain, kustomizeRenderer{dir: opts.Kustomize})
+	}
+
+	if opts.ImageRegistry != "" || opts.ImagePullSecret != "" {
+		chain = append(chain, imageRenderer{registry: opts.ImageRegistry, pullSecret: opts.ImagePullSecret})
+	}
+
+	if len(opts.Labels) > 0 || len(opts.Annotations) > 0 {
+		chain = append(chain, metadataRenderer{labels: opts.Labels, annotations: opts.Annotations})
+	}
+
+	if len(chain) == 0 {
+		return nil, nil
+	}
+	return chain, nil
+}
+
+// kustomizeRenderer applies the kustomization in dir to the rendered manifests, which are added to its resources
+type kustomizeRenderer struct {
+	dir string
+}
+
+func (k kustomizeRenderer) Run(manifests *bytes.Buffer) (*bytes.Buffer, error) {
+	fs := filesys.MakeFsInMemory()
+
+	// copy the kustomization directory so patches and resources resolve relative to it
+	err := filepath.WalkDir(k.dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(k.dir, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join("/kustomize", rel)
+		if entry.IsDir() {
+			return fs.MkdirAll(target)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return fs.WriteFile(target, data)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kustomization %s: %w", k.dir, err)
+	}
+
+	kustomizationFile := ""
+	for _, name := range []string{"kustomization.yaml", "kustomization.yml", "Kustomization"} {
+		if fs.Exists(filepath.Join("/kustomize", name)) {
+			kustomizationFile = filepath.Join("/kustomize", name)
+			break
+		}
+	}
+	if kustomizationFile == "" {
+		return nil, fmt.Errorf("no kustomization file found in %s", k.dir)
+	}
+
+	data, err := fs.ReadFile(kustomizationFile)
+	if err != nil {
+		return nil, err
+	}
+	kustomization := &types.Kustomization{}
+	if err := yaml.Unmarshal(data, kustomization); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", kustomizationFile, err)
+	}
+	kustomization.Resources = append(kustomization.Resources, renderedManifestsFile)
+
+	data, err = yaml.Marshal(kustomization)
+	if err != nil {
+		return nil, err
+	}
+	if err := fs.WriteFile(kustomizationFile, data); err != nil {
+		return nil, err
+	}
+	if err := fs.WriteFile(filepath.Join("/kustomize", renderedManifestsFile), manifests.Bytes()); err != nil {
+		return nil, err
+	}
+
+	resources, err := krusty.MakeKustomizer(krusty.MakeDefaultOptions()).Run(fs, "/kustomize")
+	if err != nil {
+		return nil, fmt.Errorf("kustomize failed: %w", err)
+	}
+
+	out, err := resources.AsYaml()
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewBuffer(out), nil
+}
+
+// metadataRenderer stamps labels and annotations onto every object and the pod templates of workloads
+type metadataRenderer struct {
+	labels      map[string]string
+	annotations map[string]string
+}
+
+// podTemplatePaths are where each workload kind keeps the template of the pods it creates
+var podTemplatePaths = map[string][]string{
+	"Deployment":  {"spec", "template"},
+	"StatefulSet": {"spec", "template"},
+	"DaemonSet":   {"spec", "template"},
+	"ReplicaSet":  {"spec", "template"},
+	"Job":         {"spec", "template"},
+	"CronJob":     {"spec", "jobTemplate", "spec", "template"},
+}
+
+// podSpecPath returns the path to the pod spec of the object, or nil when it has none
+func podSpecPath(kind string) []string {
+	if kind == "Pod" {
+		return []string{"spec"}
+	}
+	if path, ok := podTemplatePaths[kind]; ok {
+		return append(append([]string{}, path...), "spec")
+	}
+	return nil
+}
+
+func (m metadataRenderer) Run(manifests *bytes.Buffer) (*bytes.Buffer, error) {
+	objects, err := decodeManifests(manifests)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, object := range objects {
+		m.stamp(object.Object, []string{"metadata"})
+		if path, ok := podTemplatePaths[object.GetKind()]; ok {
+			m.stamp(object.Object, append(append([]string{}, path...), "metadata"))
+		}
+	}
+
+	return encodeManifests(objects)
+}
+
+func (m metadataRenderer) stamp(object map[string]interface{}, path []string) {
+	merge := func(field string, values map[string]string) {
+		if len(values) == 0 {
+			return
+		}
+		existing, _, _ := unstructured.NestedStringMap(object, append(path, field)...)
+		if existing == nil {
+			existing = map[string]string{}
+		}
+		for k, v := range values {
+			existing[k] = v
+		}
+		unstructured.SetNestedStringMap(object, existing, append(path, field)...)
+	}
+
+	merge("labels", m.labels)
+	merge("annotations", m.annotations)
+}
+
+// decodeManifests splits a multi-document YAML stream into objects, skipping empty documents
+func decodeManifests(manifests *bytes.Buffer) ([]*unstructured.Unstructured, error) {
+	decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(manifests.Bytes()), 4096)
+
+	var objects []*unstructured.Unstructured
+	for {
+		object := map[string]interface{}{}
+		err := decoder.Decode(&object)
+		if errors.Is(err, io.EOF) {
+			return objects, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode rendered manifests: %w", err)
+		}
+		if len(object) == 0 {
+			continue
+		}
+		objects = append(objects, &unstructured.Unstructured{Object: object})
+	}
+}
+
+func encodeManifests(objects []*unstructured.Unstructured) (*bytes.Buffer, error) {
+	out := &bytes.Buffer{}
+	for _, object := range objects {
+		data, err := yaml.Marshal(object.Object)
+		if err != nil {
+			return nil, err
+		}
+		out.WriteString("---\n")
+		out.Write(data)
+	}
+	return out, nil
+}
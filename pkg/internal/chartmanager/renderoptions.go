@@ -0,0 +1,172 @@
+package chartManager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// renderOptionsKey is the data key of the secret the render options of a release are stored in
+const renderOptionsKey = "options.json"
+
+// renderOptions are the release options that change the rendered manifests. They are stored next to
+// the release, so an upgrade that does not pass them again renders the release the same way.
+type renderOptions struct {
+	PostRenderer     string            `json:"postRenderer,omitempty"`
+	PostRendererArgs []string          `json:"postRendererArgs,omitempty"`
+	Kustomize        string            `json:"kustomize,omitempty"`
+	Labels           map[string]string `json:"labels,omitempty"`
+	Annotations      map[string]string `json:"annotations,omitempty"`
+	ImageRegistry    string            `json:"imageRegistry,omitempty"`
+	ImagePullSecret  string            `json:"imagePullSecret,omitempty"`
+}
+
+// renderOptionsSecretName is the secret the render options of the release are stored in, named like
+// the secrets helm stores the release in
+func renderOptionsSecretName(releaseName string) string {
+	return "kubectl-cosmo.render." + releaseName
+}
+
+// renderOptionsOf are the render options of opts, empty collections left out so they compare equal
+// to the stored ones
+func renderOptionsOf(opts ReleaseOptions) renderOptions {
+	r := renderOptions{
+		PostRenderer:    opts.PostRenderer,
+		Kustomize:       opts.Kustomize,
+		ImageRegistry:   opts.ImageRegistry,
+		ImagePullSecret: opts.ImagePullSecret,
+	}
+	if opts.PostRenderer != "" && len(opts.PostRendererArgs) > 0 {
+		r.PostRendererArgs = opts.PostRendererArgs
+	}
+	if len(opts.Labels) > 0 {
+		r.Labels = opts.Labels
+	}
+	if len(opts.Annotations) > 0 {
+		r.Annotations = opts.Annotations
+	}
+	return r
+}
+
+// withStoredRenderOptions fills the render options opts leaves unset with the stored ones. Labels and
+// annotations are merged, those in opts winning. With opts.ResetRenderOptions the stored options are
+// dropped and the release is rendered with opts alone.
+func withStoredRenderOptions(opts ReleaseOptions, stored renderOptions) ReleaseOptions {
+	if opts.ResetRenderOptions {
+		return opts
+	}
+
+	if opts.PostRenderer == "" {
+		opts.PostRenderer = stored.PostRenderer
+		opts.PostRendererArgs = stored.PostRendererArgs
+	}
+	if opts.Kustomize == "" {
+		opts.Kustomize = stored.Kustomize
+	}
+	// the pods keep pulling from the mirror rather than going back to the upstream registries
+	if opts.ImageRegistry == "" {
+		opts.ImageRegistry = stored.ImageRegistry
+	}
+	if opts.ImagePullSecret == "" {
+		opts.ImagePullSecret = stored.ImagePullSecret
+	}
+	opts.Labels = mergeStrings(stored.Labels, opts.Labels)
+	opts.Annotations = mergeStrings(stored.Annotations, opts.Annotations)
+	return opts
+}
+
+// mergeStrings copies base and overrides into a new map, nil when both are empty
+func mergeStrings(base map[string]string, overrides map[string]string) map[string]string {
+	if len(base) == 0 && len(overrides) == 0 {
+		return nil
+	}
+	merged := maps.Clone(base)
+	if merged == nil {
+		merged = map[string]string{}
+	}
+	maps.Copy(merged, overrides)
+	return merged
+}
+
+// loadRenderOptions reads the render options stored for the release, none when nothing is stored
+func (manager *ChartManager) loadRenderOptions(ctx context.Context, releaseName string) (renderOptions, error) {
+	var stored renderOptions
+
+	client, err := manager.helmAction.KubernetesClientSet()
+	if err != nil {
+		return stored, err
+	}
+	secret, err := client.CoreV1().Secrets(manager.namespace).Get(ctx, renderOptionsSecretName(releaseName), v1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return stored, nil
+	}
+	if err != nil {
+		return stored, err
+	}
+
+	if err := json.Unmarshal(secret.Data[renderOptionsKey], &stored); err != nil {
+		return stored, fmt.Errorf("failed to read the render options of %s from secret %s: %w", releaseName, secret.Name, err)
+	}
+	return stored, nil
+}
+
+// saveRenderOptions stores the render options of opts for the release, removing the secret when
+// there are none
+func (manager *ChartManager) saveRenderOptions(ctx context.Context, releaseName string, opts ReleaseOptions) error {
+	r := renderOptionsOf(opts)
+	if reflect.DeepEqual(r, renderOptions{}) {
+		return manager.removeRenderOptions(ctx, releaseName)
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	client, err := manager.helmAction.KubernetesClientSet()
+	if err != nil {
+		return err
+	}
+	secrets := client.CoreV1().Secrets(manager.namespace)
+	secret := &corev1.Secret{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      renderOptionsSecretName(releaseName),
+			Namespace: manager.namespace,
+			Labels:    map[string]string{"app.kubernetes.io/managed-by": "kubectl-cosmo", "name": releaseName},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{renderOptionsKey: data},
+	}
+
+	existing, err := secrets.Get(ctx, secret.Name, v1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = secrets.Create(ctx, secret, v1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	existing.Data = secret.Data
+	_, err = secrets.Update(ctx, existing, v1.UpdateOptions{})
+	return err
+}
+
+// removeRenderOptions deletes the render options stored for the release
+func (manager *ChartManager) removeRenderOptions(ctx context.Context, releaseName string) error {
+	client, err := manager.helmAction.KubernetesClientSet()
+	if err != nil {
+		return err
+	}
+	err = client.CoreV1().Secrets(manager.namespace).Delete(ctx, renderOptionsSecretName(releaseName), v1.DeleteOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
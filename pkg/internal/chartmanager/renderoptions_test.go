@@ -0,0 +1,104 @@
+package chartManager
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWithStoredRenderOptions(t *testing.T) {
+	stored := renderOptions{
+		PostRenderer:     "/usr/local/bin/policy",
+		PostRendererArgs: []string{"--strict"},
+		Kustomize:        "/srv/kustomize",
+		Labels:           map[string]string{"cost-center": "1234", "team": "platform"},
+		Annotations:      map[string]string{"owner": "ops"},
+		ImageRegistry:    "registry.example.com/cosmonic",
+		ImagePullSecret:  "mirror-creds",
+	}
+
+	tests := []struct {
+		name  string
+		opts  ReleaseOptions
+		want  renderOptions
+		equal bool
+	}{
+		{
+			name:  "nothing given",
+			want:  stored,
+			equal: true,
+		},
+		{
+			name: "post renderer replaced with its arguments",
+			opts: ReleaseOptions{PostRenderer: "/usr/local/bin/other"},
+			want: renderOptions{
+				PostRenderer:    "/usr/local/bin/other",
+				Kustomize:       stored.Kustomize,
+				Labels:          stored.Labels,
+				Annotations:     stored.Annotations,
+				ImageRegistry:   stored.ImageRegistry,
+				ImagePullSecret: stored.ImagePullSecret,
+			},
+		},
+		{
+			name: "labels merged",
+			opts: ReleaseOptions{Labels: map[string]string{"team": "edge", "env": "prod"}},
+			want: renderOptions{
+				PostRenderer:     stored.PostRenderer,
+				PostRendererArgs: stored.PostRendererArgs,
+				Kustomize:        stored.Kustomize,
+				Labels:           map[string]string{"cost-center": "1234", "team": "edge", "env": "prod"},
+				Annotations:      stored.Annotations,
+				ImageRegistry:    stored.ImageRegistry,
+				ImagePullSecret:  stored.ImagePullSecret,
+			},
+		},
+		{
+			name:  "same labels again",
+			opts:  ReleaseOptions{Labels: map[string]string{"team": "platform"}},
+			want:  stored,
+			equal: true,
+		},
+		{
+			name: "image registry replaced, pull secret kept",
+			opts: ReleaseOptions{ImageRegistry: "mirror.internal/cosmonic"},
+			want: renderOptions{
+				PostRenderer:     stored.PostRenderer,
+				PostRendererArgs: stored.PostRendererArgs,
+				Kustomize:        stored.Kustomize,
+				Labels:           stored.Labels,
+				Annotations:      stored.Annotations,
+				ImageRegistry:    "mirror.internal/cosmonic",
+				ImagePullSecret:  stored.ImagePullSecret,
+			},
+		},
+		{
+			name: "reset",
+			opts: ReleaseOptions{ResetRenderOptions: true, Labels: map[string]string{"env": "prod"}},
+			want: renderOptions{Labels: map[string]string{"env": "prod"}},
+		},
+		{
+			name: "reset to nothing",
+			opts: ReleaseOptions{ResetRenderOptions: true},
+			want: renderOptions{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := renderOptionsOf(withStoredRenderOptions(tt.opts, stored))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("withStoredRenderOptions() = %+v, want %+v", got, tt.want)
+			}
+			if equal := reflect.DeepEqual(got, stored); equal != tt.equal {
+				t.Errorf("equal to the stored options = %v, want %v", equal, tt.equal)
+			}
+		})
+	}
+}
+
+func TestWithStoredRenderOptionsNothingStored(t *testing.T) {
+	got := renderOptionsOf(withStoredRenderOptions(ReleaseOptions{Labels: map[string]string{}}, renderOptions{}))
+	if !reflect.DeepEqual(got, renderOptions{}) {
+		t.Errorf("withStoredRenderOptions() = %+v, want no options", got)
+	}
+}
@@ -0,0 +1,184 @@
+package chartManager
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2/content"
+	"oras.land/oras-go/v2/registry/remote"
+	"oras.land/oras-go/v2/registry/remote/auth"
+	"oras.land/oras-go/v2/registry/remote/credentials"
+	"oras.land/oras-go/v2/registry/remote/retry"
+)
+
+const (
+	// cosignSignatureAnnotation holds the base64 signature of a cosign simple signing layer
+	cosignSignatureAnnotation = "dev.cosignproject.cosign/signature"
+	// maxSignaturePayload bounds the simple signing payload read from the registry
+	maxSignaturePayload = 1 << 20
+)
+
+// ErrSignatureVerification is returned when no signature of the chart verifies against the supplied keys
+var ErrSignatureVerification = errors.New("chart signature verification failed")
+
+// simpleSigning is the payload cosign signs, binding the signature to a manifest digest
+type simpleSigning struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+	} `json:"critical"`
+}
+
+// VerifyChartSignature checks the cosign signature stored next to the chart artifact in the registry
+// against the public keys in keyFiles. It succeeds when any signature verifies with any of the keys,
+// returning the manifest digest that was verified so the chart can be pulled by it.
+func (manager *ChartManager) VerifyChartSignature(ctx context.Context, chartName string, version string, keyFiles []string) (string, error) {
+	keys, err := loadPublicKeys(keyFiles)
+	if err != nil {
+		return "", err
+	}
+
+	repo, err := manager.authenticatedRepository(chartName)
+	if err != nil {
+		return "", err
+	}
+
+	chartDesc, err := repo.Resolve(ctx, version)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s:%s: %w", chartName, version, err)
+	}
+
+	// cosign stores the signature of a manifest under the tag sha256-<hex>.sig
+	signatureTag := strings.Replace(chartDesc.Digest.String(), ":", "-", 1) + ".sig"
+	signatureDesc, err := repo.Resolve(ctx, signatureTag)
+	if err != nil {
+		return "", fmt.Errorf("%w: no signature found for %s:%s", ErrSignatureVerification, chartName, version)
+	}
+
+	manifestData, err := content.FetchAll(ctx, repo, signatureDesc)
+	if err != nil {
+		return "", err
+	}
+	var manifest ocispec.Manifest
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return "", fmt.Errorf("failed to parse signature manifest: %w", err)
+	}
+
+	for _, layer := range manifest.Layers {
+		encoded, ok := layer.Annotations[cosignSignatureAnnotation]
+		if !ok || layer.Size > maxSignaturePayload {
+			continue
+		}
+		signature, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			continue
+		}
+
+		payload, err := content.FetchAll(ctx, repo, layer)
+		if err != nil {
+			return "", err
+		}
+
+		var signed simpleSigning
+		if err := json.Unmarshal(payload, &signed); err != nil {
+			continue
+		}
+		if signed.Critical.Image.DockerManifestDigest != chartDesc.Digest.String() {
+			continue
+		}
+
+		for _, key := range keys {
+			if verifySignature(key, payload, signature) {
+				return chartDesc.Digest.String(), nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("%w: no signature of %s:%s matches the supplied keys", ErrSignatureVerification, chartName, version)
+}
+
+// authenticatedRepository opens the chart repository with the credentials helm registry commands use,
+// the helm registry config falling back to the docker one
+func (manager *ChartManager) authenticatedRepository(chartName string) (*remote.Repository, error) {
+	repo, err := remote.NewRepository(strings.TrimPrefix(manager.chartRegistryName(chartName), "oci://"))
+	if err != nil {
+		return nil, err
+	}
+
+	storeOptions := credentials.StoreOptions{DetectDefaultNativeStore: true}
+	var store credentials.Store
+	store, err = credentials.NewStore(manager.settings.RegistryConfig, storeOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the registry credentials in %s: %w", manager.settings.RegistryConfig, err)
+	}
+	if dockerStore, err := credentials.NewStoreFromDocker(storeOptions); err == nil {
+		store = credentials.NewStoreWithFallbacks(store, dockerStore)
+	}
+
+	repo.Client = &auth.Client{
+		Client:     retry.DefaultClient,
+		Cache:      auth.NewCache(),
+		Credential: credentials.Credential(store),
+	}
+	return repo, nil
+}
+
+// loadPublicKeys reads PEM encoded public keys, several may be concatenated in one file
+func loadPublicKeys(keyFiles []string) ([]crypto.PublicKey, error) {
+	var keys []crypto.PublicKey
+	for _, file := range keyFiles {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		for {
+			var block *pem.Block
+			block, data = pem.Decode(data)
+			if block == nil {
+				break
+			}
+			key, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse public key in %s: %w", file, err)
+			}
+			keys = append(keys, key)
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no public keys found to verify the chart signature")
+	}
+	return keys, nil
+}
+
+func verifySignature(key crypto.PublicKey, payload []byte, signature []byte) bool {
+	digest := sha256.Sum256(payload)
+
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(k, digest[:], signature)
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], signature) == nil {
+			return true
+		}
+		return rsa.VerifyPSS(k, crypto.SHA256, digest[:], signature, nil) == nil
+	case ed25519.PublicKey:
+		return ed25519.Verify(k, payload, signature)
+	}
+	return false
+}
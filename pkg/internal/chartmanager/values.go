@@ -0,0 +1,70 @@
+package chartManager
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+// HasValue tells whether the chart declares the value at path, in its default values or in the
+// properties of its values.schema.json. Values of subcharts are only found under their chart name.
+func HasValue(chrt *chart.Chart, path []string) bool {
+	if len(path) == 0 {
+		return false
+	}
+	return hasDefaultValue(chrt.Values, path) || hasSchemaProperty(chrt.Schema, path)
+}
+
+func hasDefaultValue(values map[string]interface{}, path []string) bool {
+	for i, key := range path {
+		value, ok := values[key]
+		if !ok {
+			return false
+		}
+		if i == len(path)-1 {
+			return true
+		}
+		if values, ok = value.(map[string]interface{}); !ok {
+			return false
+		}
+	}
+	return false
+}
+
+func hasSchemaProperty(schema []byte, path []string) bool {
+	if len(schema) == 0 {
+		return false
+	}
+	var node map[string]interface{}
+	if err := json.Unmarshal(schema, &node); err != nil {
+		return false
+	}
+
+	for _, key := range path {
+		properties, ok := node["properties"].(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if node, ok = properties[key].(map[string]interface{}); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// checkRequiredValues fails when the chart does not declare every one of the dotted value paths, so
+// values the chart does not know about are not silently ignored
+func checkRequiredValues(chrt *chart.Chart, paths []string) error {
+	var missing []string
+	for _, path := range paths {
+		if !HasValue(chrt, strings.Split(path, ".")) {
+			missing = append(missing, path)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("chart %s %s does not support the values %s", chrt.Name(), chrt.Metadata.Version, strings.Join(missing, ", "))
+	}
+	return nil
+}
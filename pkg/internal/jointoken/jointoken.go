@@ -0,0 +1,243 @@
+package jointoken
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// tokenPrefix marks a join token so it is not mistaken for another base64 blob
+	tokenPrefix = "cosmojoin."
+	// defaultPort is the NATS client port used when the endpoint has none
+	defaultPort = "4222"
+
+	// EndpointKey, CAKey and CredentialsKey are the data keys of the secret a join bundle is stored in
+	EndpointKey    = "endpoint"
+	CAKey          = "ca.crt"
+	CredentialsKey = "nats.creds"
+
+	// managedByLabel and managedBy mark the secrets Apply creates, the only ones Remove deletes
+	managedByLabel = "app.kubernetes.io/managed-by"
+	managedBy      = "kubectl-cosmo"
+)
+
+// Bundle is what a hostgroup in another cluster needs to join a nexus
+type Bundle struct {
+	// Endpoint is the NATS URL of the nexus, such as tls://nexus.example.com:4222
+	Endpoint string `json:"endpoint"`
+	// CA is the PEM encoded certificate authority the endpoint is verified against
+	CA []byte `json:"ca,omitempty"`
+	// Credentials is the NATS creds file the hosts connect with
+	Credentials []byte    `json:"credentials,omitempty"`
+	IssuedAt    time.Time `json:"issuedAt"`
+}
+
+// serverInfo is the part of the NATS INFO message the reachability check reads
+type serverInfo struct {
+	TLSRequired  bool `json:"tls_required"`
+	TLSAvailable bool `json:"tls_available"`
+}
+
+// Encode validates the bundle and encodes it as a token
+func Encode(bundle *Bundle) (string, error) {
+	if err := bundle.validate(); err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(bundle)
+	if err != nil {
+		return "", err
+	}
+	return tokenPrefix + base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// IsToken reports whether the value looks like a join token rather than, say, a file name
+func IsToken(value string) bool {
+	return strings.HasPrefix(strings.TrimSpace(value), tokenPrefix)
+}
+
+// Decode reads and validates the bundle of a token
+func Decode(token string) (*Bundle, error) {
+	token = strings.TrimSpace(token)
+	if !IsToken(token) {
+		return nil, errors.New("join token is not in the expected format")
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(strings.TrimPrefix(token, tokenPrefix), "="))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode join token: %w", err)
+	}
+
+	bundle := &Bundle{}
+	if err := json.Unmarshal(data, bundle); err != nil {
+		return nil, fmt.Errorf("failed to decode join token: %w", err)
+	}
+	if err := bundle.validate(); err != nil {
+		return nil, err
+	}
+	return bundle, nil
+}
+
+func (b *Bundle) validate() error {
+	if _, err := b.Address(); err != nil {
+		return err
+	}
+	if len(b.CA) > 0 {
+		if _, err := b.certPool(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Address is the host:port of the endpoint
+func (b *Bundle) Address() (string, error) {
+	endpoint, err := url.Parse(b.Endpoint)
+	if err != nil || endpoint.Hostname() == "" {
+		return "", fmt.Errorf("endpoint %q is not a NATS URL such as tls://nexus.example.com:4222", b.Endpoint)
+	}
+
+	port := endpoint.Port()
+	if port == "" {
+		port = defaultPort
+	}
+	return net.JoinHostPort(endpoint.Hostname(), port), nil
+}
+
+func (b *Bundle) certPool() (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b.CA) {
+		return nil, errors.New("the CA of the join bundle holds no PEM certificate")
+	}
+	return pool, nil
+}
+
+// CheckReachable connects to the endpoint and reads the INFO message every NATS server sends first.
+// When the server requires TLS, or the bundle has a CA, the TLS handshake is done and the server
+// certificate verified against the CA.
+func CheckReachable(ctx context.Context, bundle *Bundle, timeout time.Duration) error {
+	address, err := bundle.Address()
+	if err != nil {
+		return err
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("no response from %s: %w", address, err)
+	}
+	payload, ok := strings.CutPrefix(strings.TrimSpace(line), "INFO ")
+	if !ok {
+		return fmt.Errorf("%s is not a NATS server", address)
+	}
+
+	var info serverInfo
+	if err := json.Unmarshal([]byte(payload), &info); err != nil {
+		return fmt.Errorf("%s sent an invalid INFO message: %w", address, err)
+	}
+	if !info.TLSRequired && !(info.TLSAvailable && len(bundle.CA) > 0) {
+		return nil
+	}
+
+	host, _, _ := net.SplitHostPort(address)
+	config := &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+	if len(bundle.CA) > 0 {
+		if config.RootCAs, err = bundle.certPool(); err != nil {
+			return err
+		}
+	}
+
+	if err := tls.Client(conn, config).HandshakeContext(ctx); err != nil {
+		return fmt.Errorf("TLS handshake with %s failed: %w", address, err)
+	}
+	return nil
+}
+
+// Apply stores the bundle in the named secret, creating the namespace if needed
+func Apply(ctx context.Context, client kubernetes.Interface, namespace string, name string, bundle *Bundle) error {
+	_, err := client.CoreV1().Namespaces().Get(ctx, namespace, v1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		ns := &corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: namespace}}
+		if _, err := client.CoreV1().Namespaces().Create(ctx, ns, v1.CreateOptions{}); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	secrets := client.CoreV1().Secrets(namespace)
+	secret := &corev1.Secret{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    map[string]string{managedByLabel: managedBy},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{EndpointKey: []byte(bundle.Endpoint)},
+	}
+	if len(bundle.CA) > 0 {
+		secret.Data[CAKey] = bundle.CA
+	}
+	if len(bundle.Credentials) > 0 {
+		secret.Data[CredentialsKey] = bundle.Credentials
+	}
+
+	existing, err := secrets.Get(ctx, name, v1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = secrets.Create(ctx, secret, v1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	secret.ResourceVersion = existing.ResourceVersion
+	_, err = secrets.Update(ctx, secret, v1.UpdateOptions{})
+	return err
+}
+
+// Remove deletes the named secret when Apply created it, a missing secret is not an error
+func Remove(ctx context.Context, client kubernetes.Interface, namespace string, name string) error {
+	secrets := client.CoreV1().Secrets(namespace)
+	secret, err := secrets.Get(ctx, name, v1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if secret.Labels[managedByLabel] != managedBy {
+		return nil
+	}
+
+	err = secrets.Delete(ctx, name, v1.DeleteOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,266 @@
+package jointoken
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// testCA is a self-signed PEM certificate
+func testCA(t *testing.T) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestEncodeDecode(t *testing.T) {
+	ca := testCA(t)
+	issuedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		bundle *Bundle
+	}{
+		{name: "endpoint only", bundle: &Bundle{Endpoint: "nats://nexus.example.com:4222", IssuedAt: issuedAt}},
+		{name: "with CA and credentials", bundle: &Bundle{Endpoint: "tls://nexus.example.com", CA: ca, Credentials: []byte("creds"), IssuedAt: issuedAt}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := Encode(tt.bundle)
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			if !IsToken(token) {
+				t.Errorf("IsToken(%q) = false", token)
+			}
+
+			got, err := Decode(" " + token + "\n")
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.bundle) {
+				t.Errorf("Decode() = %+v, want %+v", got, tt.bundle)
+			}
+		})
+	}
+}
+
+func TestEncodeInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		bundle *Bundle
+	}{
+		{name: "no endpoint", bundle: &Bundle{}},
+		{name: "endpoint without host", bundle: &Bundle{Endpoint: "nexus:4222"}},
+		{name: "CA without certificate", bundle: &Bundle{Endpoint: "tls://nexus.example.com", CA: []byte("not PEM")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Encode(tt.bundle); err == nil {
+				t.Error("Encode() succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	encode := func(payload string) string {
+		return tokenPrefix + base64.RawURLEncoding.EncodeToString([]byte(payload))
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "no prefix", token: base64.RawURLEncoding.EncodeToString([]byte(`{"endpoint":"nats://nexus:4222"}`))},
+		{name: "not base64", token: tokenPrefix + "!!!"},
+		{name: "not JSON", token: encode("endpoint")},
+		{name: "invalid endpoint", token: encode(`{"endpoint":"::"}`)},
+		{name: "invalid CA", token: encode(`{"endpoint":"nats://nexus:4222","ca":"bm90IFBFTQ"}`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decode(tt.token); err == nil {
+				t.Errorf("Decode(%q) succeeded, want an error", tt.token)
+			}
+		})
+	}
+}
+
+func TestAddress(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		want     string
+		wantErr  bool
+	}{
+		{endpoint: "nats://nexus.example.com:4222", want: "nexus.example.com:4222"},
+		{endpoint: "tls://nexus.example.com:7422", want: "nexus.example.com:7422"},
+		{endpoint: "tls://nexus.example.com", want: "nexus.example.com:4222"},
+		{endpoint: "nats://[::1]:4222", want: "[::1]:4222"},
+		{endpoint: "nexus.example.com:4222", wantErr: true},
+		{endpoint: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.endpoint, func(t *testing.T) {
+			got, err := (&Bundle{Endpoint: tt.endpoint}).Address()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Address() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Address() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckReachable(t *testing.T) {
+	tests := []struct {
+		name     string
+		greeting string
+		wantErr  bool
+	}{
+		{name: "NATS server", greeting: "INFO {\"server_id\":\"test\",\"tls_required\":false}\r\n"},
+		{name: "not NATS", greeting: "HTTP/1.1 400 Bad Request\r\n", wantErr: true},
+		{name: "invalid INFO", greeting: "INFO {\r\n", wantErr: true},
+		{name: "no greeting", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer listener.Close()
+
+			go func() {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				if tt.greeting != "" {
+					conn.Write([]byte(tt.greeting))
+				} else {
+					time.Sleep(500 * time.Millisecond)
+				}
+			}()
+
+			bundle := &Bundle{Endpoint: "nats://" + listener.Addr().String()}
+			err = CheckReachable(context.Background(), bundle, 200*time.Millisecond)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckReachable() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	bundle := &Bundle{Endpoint: "tls://nexus.example.com:4222", CA: testCA(t), Credentials: []byte("creds")}
+
+	tests := []struct {
+		name     string
+		existing bool
+	}{
+		{name: "create"},
+		{name: "update", existing: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset()
+			ctx := context.Background()
+			if tt.existing {
+				if err := Apply(ctx, client, "cosmonic-system", "hostgroup-join", &Bundle{Endpoint: "nats://old:4222"}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := Apply(ctx, client, "cosmonic-system", "hostgroup-join", bundle); err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+
+			secret, err := client.CoreV1().Secrets("cosmonic-system").Get(ctx, "hostgroup-join", v1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := map[string][]byte{EndpointKey: []byte(bundle.Endpoint), CAKey: bundle.CA, CredentialsKey: bundle.Credentials}
+			if !reflect.DeepEqual(secret.Data, want) {
+				t.Errorf("secret data = %q, want %q", secret.Data, want)
+			}
+		})
+	}
+}
+
+func TestRemove(t *testing.T) {
+	tests := []struct {
+		name     string
+		secret   *corev1.Secret
+		wantKept bool
+	}{
+		{name: "missing"},
+		{
+			name:   "created by Apply",
+			secret: &corev1.Secret{ObjectMeta: v1.ObjectMeta{Name: "hostgroup-join", Namespace: "cosmonic-system", Labels: map[string]string{managedByLabel: managedBy}}},
+		},
+		{
+			name:     "created by someone else",
+			secret:   &corev1.Secret{ObjectMeta: v1.ObjectMeta{Name: "hostgroup-join", Namespace: "cosmonic-system"}},
+			wantKept: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset()
+			ctx := context.Background()
+			if tt.secret != nil {
+				if _, err := client.CoreV1().Secrets("cosmonic-system").Create(ctx, tt.secret, v1.CreateOptions{}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := Remove(ctx, client, "cosmonic-system", "hostgroup-join"); err != nil {
+				t.Fatalf("Remove() error = %v", err)
+			}
+
+			_, err := client.CoreV1().Secrets("cosmonic-system").Get(ctx, "hostgroup-join", v1.GetOptions{})
+			if kept := err == nil; kept != tt.wantKept {
+				t.Errorf("secret kept = %v, want %v", kept, tt.wantKept)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package license
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// SecretName is the secret Cosmonic Control reads the license key from
+	SecretName = "cosmonic-license"
+	// SecretKey is the data key holding the license key within the secret
+	SecretKey = "license"
+)
+
+var ErrNotInstalled = errors.New("no license is installed")
+
+// License is the decoded content of a license key
+type License struct {
+	Licensee     string    `json:"licensee"`
+	Entitlements []string  `json:"entitlements,omitempty"`
+	IssuedAt     time.Time `json:"issuedAt,omitempty"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+}
+
+type claims struct {
+	Subject      string   `json:"sub"`
+	Licensee     string   `json:"licensee"`
+	Name         string   `json:"name"`
+	Entitlements []string `json:"entitlements"`
+	IssuedAt     int64    `json:"iat"`
+	ExpiresAt    int64    `json:"exp"`
+}
+
+// Decode reads the claims of a license key without verifying its signature, that is left to Cosmonic Control
+func Decode(key string) (*License, error) {
+	parts := strings.Split(strings.TrimSpace(key), ".")
+	if len(parts) != 3 {
+		return nil, errors.New("license key is not in the expected format")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode license key: %w", err)
+	}
+
+	var c claims
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return nil, fmt.Errorf("failed to decode license key: %w", err)
+	}
+	if c.ExpiresAt == 0 {
+		return nil, errors.New("license key has no expiry")
+	}
+
+	license := &License{
+		Licensee:     c.Licensee,
+		Entitlements: c.Entitlements,
+		ExpiresAt:    time.Unix(c.ExpiresAt, 0).UTC(),
+	}
+	if license.Licensee == "" {
+		license.Licensee = c.Name
+	}
+	if license.Licensee == "" {
+		license.Licensee = c.Subject
+	}
+	if c.IssuedAt > 0 {
+		license.IssuedAt = time.Unix(c.IssuedAt, 0).UTC()
+	}
+
+	return license, nil
+}
+
+// Expired reports whether the license has expired
+func (l *License) Expired() bool {
+	return !time.Now().Before(l.ExpiresAt)
+}
+
+// DaysRemaining is the number of whole days until the license expires, negative once expired
+func (l *License) DaysRemaining() int {
+	remaining := time.Until(l.ExpiresAt)
+	if remaining < 0 {
+		return int(remaining.Hours()/24) - 1
+	}
+	return int(remaining.Hours() / 24)
+}
+
+// Load reads and decodes the license installed in the namespace
+func Load(ctx context.Context, client kubernetes.Interface, namespace string) (*License, error) {
+	secret, err := client.CoreV1().Secrets(namespace).Get(ctx, SecretName, v1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, ErrNotInstalled
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := secret.Data[SecretKey]
+	if !ok {
+		return nil, ErrNotInstalled
+	}
+
+	return Decode(string(key))
+}
+
+// Apply validates the license key and stores it in the license secret, creating the namespace if needed
+func Apply(ctx context.Context, client kubernetes.Interface, namespace string, key string) (*License, error) {
+	key = strings.TrimSpace(key)
+	license, err := Decode(key)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = client.CoreV1().Namespaces().Get(ctx, namespace, v1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		ns := &corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: namespace}}
+		if _, err := client.CoreV1().Namespaces().Create(ctx, ns, v1.CreateOptions{}); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	secrets := client.CoreV1().Secrets(namespace)
+	secret := &corev1.Secret{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      SecretName,
+			Namespace: namespace,
+			Labels:    map[string]string{"app.kubernetes.io/managed-by": "kubectl-cosmo"},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{SecretKey: []byte(key)},
+	}
+
+	existing, err := secrets.Get(ctx, SecretName, v1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = secrets.Create(ctx, secret, v1.CreateOptions{})
+		return license, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// only the key is replaced, the labels, annotations and other data of the secret are kept
+	if existing.Data == nil {
+		existing.Data = map[string][]byte{}
+	}
+	existing.Data[SecretKey] = []byte(key)
+	_, err = secrets.Update(ctx, existing, v1.UpdateOptions{})
+	return license, err
+}
+
+// Remove deletes the license secret
+func Remove(ctx context.Context, client kubernetes.Interface, namespace string) error {
+	err := client.CoreV1().Secrets(namespace).Delete(ctx, SecretName, v1.DeleteOptions{})
+	if apierrors.IsNotFound(err) {
+		return ErrNotInstalled
+	}
+	return err
+}
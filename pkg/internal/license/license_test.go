@@ -0,0 +1,125 @@
+package license
+
+import (
+	"context"
+	"encoding/base64"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// key builds an unsigned license key around the JSON claims
+func key(claims string) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"EdDSA","typ":"JWT"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(claims))
+	return header + "." + payload + ".signature"
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		want    *License
+		wantErr bool
+	}{
+		{
+			name: "all claims",
+			key:  key(`{"licensee":"Acme","entitlements":["hostgroups"],"iat":1700000000,"exp":1800000000}`),
+			want: &License{
+				Licensee:     "Acme",
+				Entitlements: []string{"hostgroups"},
+				IssuedAt:     time.Unix(1700000000, 0).UTC(),
+				ExpiresAt:    time.Unix(1800000000, 0).UTC(),
+			},
+		},
+		{
+			name: "licensee from name",
+			key:  key(`{"name":"Acme Corp","sub":"acme","exp":1800000000}`),
+			want: &License{Licensee: "Acme Corp", ExpiresAt: time.Unix(1800000000, 0).UTC()},
+		},
+		{
+			name: "licensee from subject",
+			key:  key(`{"sub":"acme","exp":1800000000}`),
+			want: &License{Licensee: "acme", ExpiresAt: time.Unix(1800000000, 0).UTC()},
+		},
+		{
+			name: "surrounding whitespace",
+			key:  "\n " + key(`{"licensee":"Acme","exp":1800000000}`) + "\n",
+			want: &License{Licensee: "Acme", ExpiresAt: time.Unix(1800000000, 0).UTC()},
+		},
+		{
+			name: "padded payload",
+			key:  "header." + base64.URLEncoding.EncodeToString([]byte(`{"licensee":"Acme Inc","exp":1800000000}`)) + ".signature",
+			want: &License{Licensee: "Acme Inc", ExpiresAt: time.Unix(1800000000, 0).UTC()},
+		},
+		{
+			name:    "no expiry",
+			key:     key(`{"licensee":"Acme"}`),
+			wantErr: true,
+		},
+		{
+			name:    "two parts",
+			key:     "header.payload",
+			wantErr: true,
+		},
+		{
+			name:    "payload not base64",
+			key:     "header.!!!.signature",
+			wantErr: true,
+		},
+		{
+			name:    "payload not JSON",
+			key:     "header." + base64.RawURLEncoding.EncodeToString([]byte("not json")) + ".signature",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode(tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decode() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyKeepsExistingSecret(t *testing.T) {
+	existing := &corev1.Secret{
+		ObjectMeta: v1.ObjectMeta{
+			Name:        SecretName,
+			Namespace:   "cosmonic-system",
+			Labels:      map[string]string{"team": "platform"},
+			Annotations: map[string]string{"reflector.v1.k8s.emberstack.com/reflection-allowed": "true"},
+		},
+		Data: map[string][]byte{SecretKey: []byte("old"), "notes": []byte("renewed yearly")},
+	}
+	namespace := &corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "cosmonic-system"}}
+	client := fake.NewClientset(namespace, existing)
+
+	newKey := key(`{"licensee":"Acme","exp":1893456000}`)
+	if _, err := Apply(context.Background(), client, "cosmonic-system", newKey); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	secret, err := client.CoreV1().Secrets("cosmonic-system").Get(context.Background(), SecretName, v1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(secret.Data[SecretKey]); got != newKey {
+		t.Errorf("license key = %q, want %q", got, newKey)
+	}
+	if got := string(secret.Data["notes"]); got != "renewed yearly" {
+		t.Errorf("other data = %q, want it kept", got)
+	}
+	if !reflect.DeepEqual(secret.Labels, existing.Labels) || !reflect.DeepEqual(secret.Annotations, existing.Annotations) {
+		t.Errorf("metadata = %v %v, want it kept", secret.Labels, secret.Annotations)
+	}
+}
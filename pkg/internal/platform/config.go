@@ -0,0 +1,80 @@
+package platform
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Config is the desired state of a Cosmonic Control install
+type Config struct {
+	// Namespace the releases are installed in, cosmonic-system when empty
+	Namespace string `json:"namespace,omitempty"`
+	// Registry the charts are pulled from, oci://ghcr.io/cosmonic when empty
+	Registry   string      `json:"registry,omitempty"`
+	License    *License    `json:"license,omitempty"`
+	Nexus      Release     `json:"nexus"`
+	Hostgroups []Hostgroup `json:"hostgroups,omitempty"`
+}
+
+// License points at the license key to apply
+type License struct {
+	// File is the path of the license key, relative to the config file
+	File string `json:"file"`
+}
+
+// Release is the chart version and values of a component, the latest version when Version is empty
+type Release struct {
+	Version string                 `json:"version,omitempty"`
+	Values  map[string]interface{} `json:"values,omitempty"`
+}
+
+// Hostgroup is a hostgroup release, Name being the helm release name
+type Hostgroup struct {
+	Name    string `json:"name"`
+	Release `json:",inline"`
+}
+
+// Load reads and validates the config file, resolving the license file relative to it
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &Config{}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	if config.License != nil && config.License.File != "" && !filepath.IsAbs(config.License.File) {
+		config.License.File = filepath.Join(filepath.Dir(path), config.License.File)
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// Validate checks that hostgroups are named uniquely
+func (c *Config) Validate() error {
+	names := map[string]bool{}
+	for _, hostgroup := range c.Hostgroups {
+		if hostgroup.Name == "" {
+			return errors.New("every hostgroup needs a name")
+		}
+		if names[hostgroup.Name] {
+			return fmt.Errorf("hostgroup %q is declared more than once", hostgroup.Name)
+		}
+		names[hostgroup.Name] = true
+	}
+
+	if c.License != nil && c.License.File == "" {
+		return errors.New("license needs a file")
+	}
+	return nil
+}